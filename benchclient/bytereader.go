@@ -3,6 +3,8 @@ package benchclient
 import (
 	"bytes"
 	"io"
+
+	sion "github.com/sionreview/sion/client"
 )
 
 type ByteReader struct {
@@ -14,7 +16,7 @@ type ByteReader struct {
 func NewByteReader(b []byte) *ByteReader {
 	return &ByteReader{
 		Reader: bytes.NewReader(b),
-		buf: b,
+		buf:    b,
 	}
 }
 
@@ -23,3 +25,13 @@ func (r *ByteReader) Len() int { return len(r.buf) }
 func (r *ByteReader) ReadAll() ([]byte, error) { return r.buf, nil }
 
 func (r *ByteReader) Close() error { return nil }
+
+// Clone returns a reader of the same bytes that reads from the first byte.
+func (r *ByteReader) Clone() sion.ReadAllCloser {
+	return NewByteReader(r.buf)
+}
+
+// Rewind resets the reader to read from the first byte.
+func (r *ByteReader) Rewind() {
+	r.Reader = bytes.NewReader(r.buf)
+}
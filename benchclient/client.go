@@ -2,6 +2,7 @@ package benchclient
 
 import (
 	"errors"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -36,14 +37,21 @@ type Client interface {
 	Close()
 }
 
-type clientSetter func(string, []byte) error
+type clientSetter func(string, sion.ReadAllCloser) error
 type clientGetter func(string) (sion.ReadAllCloser, error)
 
+// Retainer Clients that can retain bytes of streamed objects regardless of DiscardReads, e.g. backends of erasure
+// coding that decode shards read.
+type Retainer interface {
+	RetainReads(retain bool)
+}
+
 type defaultClient struct {
 	log    logger.ILogger
 	setter clientSetter
 	getter clientGetter
 	abbr   string // Abbreviation for logging
+	retain bool   // Retain bytes read regardless of DiscardReads.
 }
 
 func newDefaultClient(logPrefix string) *defaultClient {
@@ -64,7 +72,17 @@ func newDefaultClientWithAccessor(logPrefix string, setter clientSetter, getter
 	}
 }
 
+// RetainReads Retainer implementation.
+func (c *defaultClient) RetainReads(retain bool) {
+	c.retain = retain
+}
+
 func (c *defaultClient) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	return c.EcSetReader(key, NewByteReader(val), args...)
+}
+
+// EcSetReader uploads the object from a stream. The size of the object is determined by reader.Len().
+func (c *defaultClient) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
 	reqId := uuid.New().String()
 
 	// Debuging options
@@ -81,15 +99,16 @@ func (c *defaultClient) EcSet(key string, val []byte, args ...interface{}) (stri
 	}
 
 	// Timing
+	size := reader.Len()
 	start := time.Now()
-	err := c.setter(key, val)
+	err := c.setter(key, reader)
 	duration := time.Since(start)
-	nanoLog(logClient, "set", key, start.UnixNano(), duration.Nanoseconds(), len(val), resultFromError(err), c.abbr)
+	nanoLog(logClient, "set", key, start.UnixNano(), int64(0), duration.Nanoseconds(), size, resultFromError(err), c.abbr)
 	if err != nil {
 		c.log.Error("Failed to upload: %v", err)
 		return reqId, err
 	}
-	c.log.Info("Set %s %v %d", key, duration, len(val))
+	c.log.Info("Set %s %v %d", key, duration, size)
 	return reqId, nil
 }
 
@@ -111,20 +130,61 @@ func (c *defaultClient) EcGet(key string, args ...interface{}) (string, sion.Rea
 	// Timing
 	start := time.Now()
 	reader, err := c.getter(key)
+	firstByte := time.Since(start)
+	if stream, ok := reader.(*StreamReader); ok {
+		reader, err = c.transfer(stream)
+		if !stream.FirstByte().IsZero() {
+			firstByte = stream.FirstByte().Sub(start)
+		}
+	}
 	duration := time.Since(start)
 	size := 0
 	if reader != nil {
 		size = reader.Len()
 	}
-	nanoLog(logClient, "get", key, start.UnixNano(), duration.Nanoseconds(), size, resultFromError(err), c.abbr)
+	nanoLog(logClient, "get", key, start.UnixNano(), firstByte.Nanoseconds(), duration.Nanoseconds(), size, resultFromError(err), c.abbr)
 	if err != nil {
 		c.log.Error("failed to download: %v", err)
 		return reqId, nil, err
 	}
-	c.log.Info("Get %s %v %d", key, duration, size)
+	c.log.Info("Get %s %v(ttfb %v) %d", key, duration, firstByte, size)
 	return reqId, reader, nil
 }
 
+// transfer reads the stream to the end. The bytes are discarded unless DiscardReads is false or the client retains
+// reads.
+func (c *defaultClient) transfer(stream *StreamReader) (sion.ReadAllCloser, error) {
+	defer stream.Close()
+
+	if !DiscardReads || c.retain {
+		buf, err := stream.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		return NewByteReader(buf), nil
+	}
+
+	if ChecksumReads {
+		n, sum, err := Digest(stream)
+		if err == nil && stream.Len() > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &drainedReader{size: n, sum: sum, summarized: true}, nil
+	}
+
+	n, err := io.Copy(io.Discard, stream)
+	if err == nil && stream.Len() > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &drainedReader{size: int(n)}, nil
+}
+
 func (c *defaultClient) Close() {
 	// Nothing
 }
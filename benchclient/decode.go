@@ -0,0 +1,331 @@
+package benchclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ScottMansfield/nanolog"
+)
+
+var (
+	ErrUnknownLogLine = errors.New("entry of unknown log line")
+	ErrInvalidLogFile = errors.New("invalid log file")
+
+	logSchemas   = make(map[string]*LogSchema)
+	logSchemasMu sync.Mutex
+
+	// logKindCodes Format codes of kinds, see nanolog.
+	logKindCodes = map[reflect.Kind]string{
+		reflect.Bool:       "b",
+		reflect.Int:        "i",
+		reflect.Int8:       "i8",
+		reflect.Int16:      "i16",
+		reflect.Int32:      "i32",
+		reflect.Int64:      "i64",
+		reflect.Uint:       "u",
+		reflect.Uint8:      "u8",
+		reflect.Uint16:     "u16",
+		reflect.Uint32:     "u32",
+		reflect.Uint64:     "u64",
+		reflect.Float32:    "f32",
+		reflect.Float64:    "f64",
+		reflect.Complex64:  "c64",
+		reflect.Complex128: "c128",
+		reflect.String:     "s",
+	}
+)
+
+func init() {
+	// Handles added by the SION client and the proxy collector, written to the same files if linked.
+	RegisterLogSchema(&LogSchema{Name: "sion", Format: "%s,%s,%i64,%i64,%i64,%i64,%i64,%b,%b,%i",
+		Columns: []string{"cmd", "reqId", "begin", "duration", "reqLatency", "recLatency", "codingLatency", "allGood", "corrupted", "size"}})
+	RegisterLogSchema(&LogSchema{Name: "chunk", Format: "%s,%s,%s,%i64,%i64,%i64,%i64,%i64,%i64,%i64,%i64,%i64,%i64",
+		Columns: []string{"cmd", "reqId", "chunk", "begin", "duration", "firstByte", "lambda2Server", "server2Client", "obsolete1", "obsolete2", "streaming", "ping", "status"}})
+	RegisterLogSchema(&LogSchema{Name: "endtoend", Format: "%s,%s,%i64,%i64,%i64",
+		Columns: []string{"cmd", "status", "bytes", "begin", "duration"}})
+	// Cluster and bucket rotation records share the format, distinguished by the type.
+	RegisterLogSchema(&LogSchema{Name: "cluster", Format: "%s,%i64,%i,%i,%i,%i",
+		Columns: []string{"type", "time", "total", "actives", "degraded", "expired"}})
+}
+
+// LogSchema Names of fields logged by a nanolog handle, matched by the format string.
+type LogSchema struct {
+	Name    string
+	Format  string
+	Columns []string
+	Kinds   []reflect.Kind // Set on decoding.
+}
+
+// ReqIdColumn returns the index of the reqId column, or -1 if the records can not be joined.
+func (s *LogSchema) ReqIdColumn() int {
+	for i, col := range s.Columns {
+		if col == "reqId" {
+			return i
+		}
+	}
+	return -1
+}
+
+// Type returns the type name of the column.
+func (s *LogSchema) Type(col int) string {
+	switch s.Kinds[col] {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String, reflect.Complex64, reflect.Complex128:
+		return "string"
+	case reflect.Float32, reflect.Float64:
+		return "float64"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint64"
+	default:
+		return "int64"
+	}
+}
+
+// RegisterLogSchema registers names of fields of the nanolog handle of the format, usually in init().
+func RegisterLogSchema(schema *LogSchema) {
+	logSchemasMu.Lock()
+	defer logSchemasMu.Unlock()
+
+	if _, ok := logSchemas[schema.Format]; ok {
+		panic(fmt.Sprintf("log schema registered twice: %s", schema.Format))
+	}
+	logSchemas[schema.Format] = schema
+}
+
+// LookupLogSchema returns the schema registered for the format, nil if not registered.
+func LookupLogSchema(format string) *LogSchema {
+	logSchemasMu.Lock()
+	defer logSchemasMu.Unlock()
+
+	return logSchemas[format]
+}
+
+// LogRecord A record decoded, values are of bool, string, int64, uint64, float64 or complex128.
+type LogRecord struct {
+	Schema *LogSchema
+	Values []interface{}
+}
+
+// ReqId returns the reqId of the record, or empty if the record can not be joined.
+func (r *LogRecord) ReqId() string {
+	if col := r.Schema.ReqIdColumn(); col >= 0 {
+		return r.Values[col].(string)
+	}
+	return ""
+}
+
+// LogDecoder Decodes records from nanolog files like *_bench.clog and *_playback.clog.
+// Log lines are described in the file, so records of handles without schemas registered are decoded as well, with
+// columns named by position.
+type LogDecoder struct {
+	r       *bufio.Reader
+	schemas map[uint32]*LogSchema
+	buf     [8]byte
+}
+
+func NewLogDecoder(r io.Reader) *LogDecoder {
+	return &LogDecoder{
+		r:       bufio.NewReader(r),
+		schemas: make(map[uint32]*LogSchema),
+	}
+}
+
+// Schemas returns schemas of log lines read so far.
+func (d *LogDecoder) Schemas() []*LogSchema {
+	ids := make([]int, 0, len(d.schemas))
+	for id := range d.schemas {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	ret := make([]*LogSchema, len(ids))
+	for i, id := range ids {
+		ret[i] = d.schemas[uint32(id)]
+	}
+	return ret
+}
+
+// Next returns the next record, or io.EOF if no more records. A file truncated, e.g. not flushed on crashing, returns
+// io.ErrUnexpectedEOF.
+func (d *LogDecoder) Next() (*LogRecord, error) {
+	for {
+		entryType, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch nanolog.EntryType(entryType) {
+		case nanolog.ETLogLine:
+			if err := d.readLogLine(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		case nanolog.ETLogEntry:
+			record, err := d.readLogEntry()
+			return record, unexpectedEOF(err)
+		default:
+			return nil, fmt.Errorf("%w: unknown entry type %d", ErrInvalidLogFile, entryType)
+		}
+	}
+}
+
+func (d *LogDecoder) readLogLine() error {
+	id, err := d.readUint32()
+	if err != nil {
+		return err
+	}
+	numSegs, err := d.readUint32()
+	if err != nil {
+		return err
+	} else if numSegs == 0 {
+		return fmt.Errorf("%w: log line %d without segments", ErrInvalidLogFile, id)
+	}
+
+	kinds := make([]reflect.Kind, numSegs-1)
+	for i := range kinds {
+		kind, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		kinds[i] = reflect.Kind(kind)
+	}
+
+	var format strings.Builder
+	for i := uint32(0); i < numSegs; i++ {
+		seg, err := d.readString()
+		if err != nil {
+			return err
+		}
+		format.WriteString(seg)
+		if int(i) < len(kinds) {
+			format.WriteString("%" + logKindCodes[kinds[i]])
+		}
+	}
+
+	schema := &LogSchema{Name: fmt.Sprintf("log%d", id), Format: format.String()}
+	if registered := LookupLogSchema(schema.Format); registered != nil && len(registered.Columns) == len(kinds) {
+		schema.Name = registered.Name
+		schema.Columns = registered.Columns
+	} else {
+		schema.Columns = make([]string, len(kinds))
+		for i := range schema.Columns {
+			schema.Columns[i] = fmt.Sprintf("col%d", i)
+		}
+	}
+	schema.Kinds = kinds
+	d.schemas[id] = schema
+	return nil
+}
+
+func (d *LogDecoder) readLogEntry() (*LogRecord, error) {
+	id, err := d.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := d.schemas[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownLogLine, id)
+	}
+
+	record := &LogRecord{Schema: schema, Values: make([]interface{}, len(schema.Kinds))}
+	for i, kind := range schema.Kinds {
+		if record.Values[i], err = d.readValue(kind); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+func (d *LogDecoder) readValue(kind reflect.Kind) (interface{}, error) {
+	switch kind {
+	case reflect.Bool:
+		b, err := d.r.ReadByte()
+		return b != 0, err
+	case reflect.String:
+		return d.readString()
+	case reflect.Int, reflect.Int64:
+		v, err := d.readBytes(8)
+		return int64(binary.LittleEndian.Uint64(v)), err
+	case reflect.Int8:
+		v, err := d.readBytes(1)
+		return int64(int8(v[0])), err
+	case reflect.Int16:
+		v, err := d.readBytes(2)
+		return int64(int16(binary.LittleEndian.Uint16(v))), err
+	case reflect.Int32:
+		v, err := d.readBytes(4)
+		return int64(int32(binary.LittleEndian.Uint32(v))), err
+	case reflect.Uint, reflect.Uint64:
+		v, err := d.readBytes(8)
+		return binary.LittleEndian.Uint64(v), err
+	case reflect.Uint8:
+		v, err := d.readBytes(1)
+		return uint64(v[0]), err
+	case reflect.Uint16:
+		v, err := d.readBytes(2)
+		return uint64(binary.LittleEndian.Uint16(v)), err
+	case reflect.Uint32:
+		v, err := d.readBytes(4)
+		return uint64(binary.LittleEndian.Uint32(v)), err
+	case reflect.Float32:
+		v, err := d.readBytes(4)
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(v))), err
+	case reflect.Float64:
+		v, err := d.readBytes(8)
+		return math.Float64frombits(binary.LittleEndian.Uint64(v)), err
+	case reflect.Complex64:
+		v, err := d.readBytes(8)
+		real, imag := math.Float32frombits(binary.LittleEndian.Uint32(v)), math.Float32frombits(binary.LittleEndian.Uint32(v[4:]))
+		return complex(float64(real), float64(imag)), err
+	case reflect.Complex128:
+		v, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		real := math.Float64frombits(binary.LittleEndian.Uint64(v))
+		v, err = d.readBytes(8)
+		return complex(real, math.Float64frombits(binary.LittleEndian.Uint64(v))), err
+	default:
+		return nil, fmt.Errorf("%w: unsupported kind %v", ErrInvalidLogFile, kind)
+	}
+}
+
+func (d *LogDecoder) readBytes(n int) ([]byte, error) {
+	buf := d.buf[:n]
+	_, err := io.ReadFull(d.r, buf)
+	return buf, err
+}
+
+func (d *LogDecoder) readUint32() (uint32, error) {
+	buf, err := d.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+func (d *LogDecoder) readString() (string, error) {
+	n, err := d.readUint32()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(d.r, buf)
+	return string(buf), err
+}
+
+// unexpectedEOF reports EOF in the middle of an entry as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -2,11 +2,14 @@ package benchclient
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	sion "github.com/sionreview/sion/client"
 	"github.com/zhangjyr/hashmap"
 )
@@ -14,7 +17,7 @@ import (
 const (
 	DummyStore          = "ds"
 	DummyCache          = "dc"
-	DummyCacheMissRatio = 50 // Miss ratio of cache, 10 means 10%
+	DummyCacheMissRatio = 50 // Default miss ratio of cache, 10 means 10%
 )
 
 var (
@@ -25,20 +28,49 @@ func ResetDummySizeRegistry() {
 	sizemap = hashmap.New(10000)
 }
 
+// DummyOptions Options of the dummy client.
+type DummyOptions struct {
+	// Bandwidth The bandwidth of the dummy client in B/s, 0 for unlimited.
+	Bandwidth int64
+
+	// Base The fixed latency per request.
+	Base time.Duration
+
+	// Latency The latency model per request in addition to the base latency, nil for none.
+	Latency LatencyModel
+
+	// MissRatio Miss ratio of the dummy cache, 10 means 10%. Ignored if Cache is set.
+	MissRatio int
+
+	// Cache The capacity-bounded LRU deciding hits of the dummy cache. Share the LRU among clients of a provider.
+	Cache *LRU
+
+	// Uplink The link shared by uploads of clients of a provider. Overrides Bandwidth on set if specified.
+	Uplink *Link
+
+	// Downlink The link shared by downloads of clients of a provider. Overrides Bandwidth on get if specified.
+	Downlink *Link
+}
+
 type Dummy struct {
 	*defaultClient
-	ctx       context.Context
-	bandwidth int64
+	ctx  context.Context
+	opts DummyOptions
 }
 
 // NewDummy returns a new dummy client.
 // bandwidth defined the bandwidth of the dummy client in B/s, 0 for unlimited.
 func NewDummy(bandwidth int64, t string) *Dummy {
+	return NewDummyWithOptions(t, DummyOptions{Bandwidth: bandwidth, MissRatio: DummyCacheMissRatio})
+}
+
+// NewDummyWithOptions returns a new dummy client with latency models and the cache model specified.
+func NewDummyWithOptions(t string, opts DummyOptions) *Dummy {
 	//client := newSession(addr)
 	client := &Dummy{
 		defaultClient: newDefaultClient(fmt.Sprintf("Dummy%s: ", strings.ToUpper(t))),
 		ctx:           context.Background(),
-		bandwidth:     bandwidth,
+		opts:          opts,
 	}
 	client.setter = client.set
 	client.getter = client.get
@@ -46,14 +78,13 @@ func NewDummy(bandwidth int64, t string) *Dummy {
 	return client
 }
 
-func (d *Dummy) set(key string, val []byte) (err error) {
-	sizemap.Set(key, len(val))
-
-	if d.bandwidth == 0 {
-		return nil
+func (d *Dummy) set(key string, reader sion.ReadAllCloser) (err error) {
+	sizemap.Set(key, reader.Len())
+	if d.abbr == DummyCache && d.opts.Cache != nil {
+		d.opts.Cache.Add(key, int64(reader.Len()), nil)
 	}
 
-	time.Sleep(d.sizeToDuration(len(val)))
+	d.simulate(reader.Len(), d.opts.Uplink)
 	return nil
 }
 
@@ -63,19 +94,42 @@ func (d *Dummy) get(key string) (sion.ReadAllCloser, error) {
 		return nil, sion.ErrNotFound
 	}
 
-	if d.abbr == DummyCache && rand.Intn(100) < DummyCacheMissRatio {
+	if d.abbr == DummyCache && d.miss(key) {
 		return nil, sion.ErrNotFound
 	}
 
-	if d.bandwidth == 0 {
-		return &DummyReadAllCloser{size: size.(int)}, nil
-	}
-	time.Sleep(d.sizeToDuration(size.(int)))
+	d.simulate(size.(int), d.opts.Downlink)
 	return &DummyReadAllCloser{size: size.(int)}, nil
 }
 
+func (d *Dummy) miss(key string) bool {
+	if d.opts.Cache != nil {
+		_, _, hit := d.opts.Cache.Get(key)
+		return !hit
+	}
+	return rand.Intn(100) < d.opts.MissRatio
+}
+
+// simulate sleeps for the base latency, the sampled latency and the transfer time.
+// The transfer time is decided by the shared link if specified, or the bandwidth of the client.
+func (d *Dummy) simulate(size int, link *Link) {
+	latency := d.opts.Base
+	if d.opts.Latency != nil {
+		latency += d.opts.Latency.Sample()
+	}
+	if link == nil && d.opts.Bandwidth > 0 {
+		latency += d.sizeToDuration(size)
+	}
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if link != nil {
+		link.Transfer(size)
+	}
+}
+
 func (d *Dummy) sizeToDuration(size int) time.Duration {
-	return time.Duration(float64(size) / float64(d.bandwidth) * float64(time.Second))
+	return time.Duration(float64(size) / float64(d.opts.Bandwidth) * float64(time.Second))
 }
 
 type DummyReadAllCloser struct {
@@ -97,3 +151,106 @@ func (r *DummyReadAllCloser) ReadAll() ([]byte, error) {
 func (r *DummyReadAllCloser) Close() error {
 	return nil
 }
+
+const (
+	ProviderDummy = "dummy"
+)
+
+func init() {
+	var enabled bool
+	var latency, failoverLatency string
+	var opts, failoverOpts DummyOptions
+	var capacity, linkUp, linkDown int64
+	var flags *flag.FlagSet
+	var links []*Link
+	var once sync.Once
+	var parseErr error
+	RegisterProvider(&Provider{
+		Name:        ProviderDummy,
+		Description: "simulated store or cache, enabled by -dummy",
+		Dual:        true,
+		RegisterFlags: func(fs *flag.FlagSet) {
+			flags = fs
+			fs.BoolVar(&enabled, "dummy", false, "using Dummy client for simulation")
+			fs.StringVar(&latency, "dummyLatency", "", "latency model of Dummy clients: constant:<d>, normal:<mean>,<stddev>, lognormal:<median>,<sigma> or empirical:<cdf file>")
+			fs.DurationVar(&opts.Base, "dummyBase", 0, "fixed latency per request of Dummy clients")
+			fs.StringVar(&failoverLatency, "failoverDummyLatency", "", "latency model of the Dummy failover, default to -dummyLatency")
+			fs.DurationVar(&failoverOpts.Base, "failoverDummyBase", 0, "fixed latency per request of the Dummy failover, default to -dummyBase")
+			fs.IntVar(&opts.MissRatio, "dummyMiss", DummyCacheMissRatio, "miss ratio in percentage of the Dummy cache, ignored if -dummyCapacity is set")
+			fs.Int64Var(&capacity, "dummyCapacity", 0, "capacity in bytes of the Dummy cache. Hits are decided by an LRU of the capacity if set")
+			fs.Int64Var(&linkUp, "linkUp", 0, "upload bandwidth in MiB/s shared by all Dummy clients of a provider, overriding -w on set. 0 to disable")
+			fs.Int64Var(&linkDown, "linkDown", 0, "download bandwidth in MiB/s shared by all Dummy clients of a provider, overriding -w on get. 0 to disable")
+		},
+		Enabled: func() bool {
+			return enabled
+		},
+		Factory: func(env *ProviderEnv) (ClientFactory, error) {
+			// Flags are parsed once, errors are returned on every call.
+			once.Do(func() {
+				ResetDummySizeRegistry()
+				opts.Latency, parseErr = ParseLatencyModel(latency)
+				if capacity > 0 {
+					opts.Cache = NewLRU(capacity)
+				}
+				if parseErr != nil {
+					return
+				}
+
+				// The failover follows the main dummy unless specified.
+				failoverOpts.Latency = opts.Latency
+				if failoverLatency != "" {
+					failoverOpts.Latency, parseErr = ParseLatencyModel(failoverLatency)
+				}
+				if !isFlagSet(flags, "failoverDummyBase") {
+					failoverOpts.Base = opts.Base
+				}
+			})
+			if parseErr != nil {
+				return nil, fmt.Errorf("invalid latency model of Dummy clients: %v", parseErr)
+			}
+
+			// The main dummy is the cache of the dummy failover.
+			t := DummyStore
+			if env.Role == ProviderRoleMain && strings.ToLower(env.Failover) == ProviderDummy {
+				t = DummyCache
+			}
+			clientOpts := opts
+			if env.Role == ProviderRoleFailover {
+				clientOpts.Base, clientOpts.Latency = failoverOpts.Base, failoverOpts.Latency
+			}
+			clientOpts.Bandwidth = env.Bandwidth
+			// Links are shared by all clients of the provider, and reused if the factory is created again.
+			link := func(name string, bandwidth int64) *Link {
+				for _, link := range links {
+					if link.Name == name {
+						return link
+					}
+				}
+				link := NewLink(name, bandwidth*1024*1024)
+				links = append(links, link)
+				return link
+			}
+			if linkUp > 0 {
+				clientOpts.Uplink = link(fmt.Sprintf("%s-up", t), linkUp)
+			}
+			if linkDown > 0 {
+				clientOpts.Downlink = link(fmt.Sprintf("%s-down", t), linkDown)
+			}
+			return func() Client {
+				return NewDummyWithOptions(t, clientOpts)
+			}, nil
+		},
+		Report: func() []string {
+			var lines []string
+			if opts.Cache != nil {
+				stats := opts.Cache.Stats()
+				lines = append(lines, fmt.Sprintf("Dummy cache %s of %s, hits %d, misses %d, evictions %d, miss ratio %.2f%%",
+					humanize.Bytes(uint64(stats.Size)), humanize.Bytes(uint64(stats.Capacity)), stats.Hits, stats.Misses, stats.Evictions, stats.MissRatio()*100))
+			}
+			for _, link := range links {
+				lines = append(lines, fmt.Sprintf("Link %v", link.Stats()))
+			}
+			return lines
+		},
+	})
+}
@@ -0,0 +1,275 @@
+package benchclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/reedsolomon"
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	// ErasureHeaderLen The length of the header of shards, which holds the size of the object.
+	ErasureHeaderLen = 8
+)
+
+var (
+	ErrInsufficientShards = errors.New("insufficient shards")
+)
+
+// ErasureOptions Options of client-side erasure coding, following the -d/-p/-g settings of SION.
+type ErasureOptions struct {
+	DataShards    int
+	ParityShards  int
+	MaxGoroutines int
+
+	// DiscardReads Count the size of shards read without decoding, e.g. in lean mode where objects are not generated.
+	// Otherwise, backends that are Retainers are set to retain bytes read for decoding.
+	DiscardReads bool
+}
+
+// ValidateErasureOptions returns the error if the shards can not be encoded by the options.
+func ValidateErasureOptions(opts ErasureOptions) error {
+	_, err := newErasureEncoder(opts)
+	return err
+}
+
+func newErasureEncoder(opts ErasureOptions) (reedsolomon.Encoder, error) {
+	var codecOpts []reedsolomon.Option
+	if opts.MaxGoroutines > 0 {
+		codecOpts = append(codecOpts, reedsolomon.WithMaxGoroutines(opts.MaxGoroutines))
+	}
+	return reedsolomon.New(opts.DataShards, opts.ParityShards, codecOpts...)
+}
+
+// ShardKey returns the key of the ith shard of the object, in the same form of chunk keys of SION.
+func ShardKey(key string, i int) string {
+	return fmt.Sprintf("%d@%s", i, key)
+}
+
+// Erasure A Client encoding objects into d+p Reed-Solomon shards. Shard i is stored as ShardKey(key, i) on backend
+// i mod the number of backends. Gets are sent for all shards, and the object is decoded from the first d shards.
+// Shards are read and decoded unless DiscardReads is set, or the backend can not retain bytes read, e.g. Dummy backends,
+// in which cases only the size is returned. Shards late are closed in background without blocking following requests.
+type Erasure struct {
+	backends []Client
+	opts     ErasureOptions
+	encoder  reedsolomon.Encoder
+	pending  sync.WaitGroup
+}
+
+type shardResult struct {
+	idx    int
+	reader sion.ReadAllCloser
+	err    error
+}
+
+func NewErasure(backends []Client, opts ErasureOptions) (*Erasure, error) {
+	if len(backends) == 0 {
+		return nil, ErrInsufficientShards
+	}
+	encoder, err := newErasureEncoder(opts)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DiscardReads {
+		for _, backend := range backends {
+			if retainer, ok := backend.(Retainer); ok {
+				retainer.RetainReads(true)
+			}
+		}
+	}
+	return &Erasure{backends: backends, opts: opts, encoder: encoder}, nil
+}
+
+func (c *Erasure) numShards() int {
+	return c.opts.DataShards + c.opts.ParityShards
+}
+
+func (c *Erasure) backend(i int) Client {
+	return c.backends[i%len(c.backends)]
+}
+
+func (c *Erasure) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	if val == nil {
+		// Nothing to encode, e.g. on dryrun.
+		return c.setShards(key, nil, args)
+	}
+	return c.EcSetReader(key, NewByteReader(val), args...)
+}
+
+// EcSetReader ReaderSetter implementation.
+func (c *Erasure) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	val, err := reader.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	shards, err := c.encode(val)
+	if err != nil {
+		return "", err
+	}
+	return c.setShards(key, shards, args)
+}
+
+func (c *Erasure) encode(val []byte) ([][]byte, error) {
+	var data [][]byte
+	if len(val) > 0 {
+		var err error
+		if data, err = c.encoder.Split(val); err != nil {
+			return nil, err
+		} else if err = c.encoder.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+
+	shards := make([][]byte, c.numShards())
+	for i := range shards {
+		var shard []byte
+		if data != nil {
+			shard = data[i]
+		}
+		shards[i] = make([]byte, ErasureHeaderLen+len(shard))
+		binary.BigEndian.PutUint64(shards[i], uint64(len(val)))
+		copy(shards[i][ErasureHeaderLen:], shard)
+	}
+	return shards, nil
+}
+
+func (c *Erasure) setShards(key string, shards [][]byte, args []interface{}) (string, error) {
+	reqId := uuid.New().String()
+	errs := make([]error, c.numShards())
+	var wg sync.WaitGroup
+	for i := 0; i < c.numShards(); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if shards == nil {
+				_, errs[i] = c.backend(i).EcSet(ShardKey(key, i), nil, args...)
+			} else {
+				_, errs[i] = setReader(c.backend(i), ShardKey(key, i), NewByteReader(shards[i]), args...)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// All shards are required to be stored.
+	for _, err := range errs {
+		if err != nil {
+			return reqId, err
+		}
+	}
+	return reqId, nil
+}
+
+func (c *Erasure) EcGet(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	reqId := uuid.New().String()
+	results := make(chan *shardResult, c.numShards())
+	c.pending.Add(c.numShards())
+	for i := 0; i < c.numShards(); i++ {
+		go func(i int) {
+			defer c.pending.Done()
+			_, reader, err := c.backend(i).EcGet(ShardKey(key, i), args...)
+			results <- &shardResult{idx: i, reader: reader, err: err}
+		}(i)
+	}
+
+	// Collect the first d shards.
+	var lastErr error
+	notFound := 0
+	consumed := 0
+	received := make([]*shardResult, 0, c.opts.DataShards)
+	for ; consumed < c.numShards() && len(received) < c.opts.DataShards; consumed++ {
+		ret := <-results
+		if ret.err == nil {
+			received = append(received, ret)
+			continue
+		} else if ret.err == sion.ErrNotFound {
+			notFound++
+		}
+		lastErr = ret.err
+	}
+	if remain := c.numShards() - consumed; remain > 0 {
+		// Close late shards.
+		go func() {
+			for ; remain > 0; remain-- {
+				if ret := <-results; ret.reader != nil {
+					ret.reader.Close()
+				}
+			}
+		}()
+	}
+
+	if len(received) < c.opts.DataShards {
+		for _, ret := range received {
+			if ret.reader != nil {
+				ret.reader.Close()
+			}
+		}
+		if notFound > c.opts.ParityShards {
+			return reqId, nil, sion.ErrNotFound
+		}
+		return reqId, nil, fmt.Errorf("%w: %v", ErrInsufficientShards, lastErr)
+	}
+
+	reader, err := c.decode(received)
+	return reqId, reader, err
+}
+
+func (c *Erasure) decode(received []*shardResult) (sion.ReadAllCloser, error) {
+	shards := make([][]byte, c.numShards())
+	size := -1
+	drained := 0
+	for _, ret := range received {
+		if ret.reader == nil {
+			// Dryrun
+			return nil, nil
+		}
+		var shard []byte
+		err := ErrNotSupported
+		if !c.opts.DiscardReads {
+			shard, err = ret.reader.ReadAll()
+		}
+		ret.reader.Close()
+		if err == ErrNotSupported {
+			// Bytes discarded, count the size only.
+			if ret.reader.Len() > ErasureHeaderLen {
+				drained += ret.reader.Len() - ErasureHeaderLen
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if len(shard) < ErasureHeaderLen {
+			return nil, fmt.Errorf("%w: shard %d is truncated", ErrInsufficientShards, ret.idx)
+		}
+		size = int(binary.BigEndian.Uint64(shard))
+		shards[ret.idx] = shard[ErasureHeaderLen:]
+	}
+	if size < 0 {
+		return &drainedReader{size: drained}, nil
+	} else if size == 0 {
+		return NewByteReader([]byte{}), nil
+	} else if drained > 0 {
+		return nil, fmt.Errorf("%w: mixed shards of bytes and sizes", ErrInsufficientShards)
+	}
+
+	if err := c.encoder.ReconstructData(shards); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	if err := c.encoder.Join(buf, shards, size); err != nil {
+		return nil, err
+	}
+	return NewByteReader(buf.Bytes()), nil
+}
+
+// Close closes backends after shards late are closed.
+func (c *Erasure) Close() {
+	c.pending.Wait()
+	for _, backend := range c.backends {
+		backend.Close()
+	}
+}
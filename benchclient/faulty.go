@@ -0,0 +1,301 @@
+package benchclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	FaultError    = "error"
+	FaultNotFound = "notfound"
+	FaultTimeout  = "timeout"
+	FaultLatency  = "latency"
+	FaultTruncate = "truncate"
+)
+
+var (
+	ErrInjected        = errors.New("injected fault")
+	ErrInjectedTimeout = errors.New("injected timeout")
+	ErrInvalidFault    = errors.New("invalid fault rule")
+
+	faultKinds = []string{FaultError, FaultNotFound, FaultTimeout, FaultLatency, FaultTruncate}
+)
+
+// FaultRule Specifies a fault to inject.
+type FaultRule struct {
+	Kind   string        // One of FaultError, FaultNotFound, FaultTimeout, FaultLatency, FaultTruncate
+	Op     string        // "get", "set", or empty for both.
+	Prefix string        // Key prefix to match, empty for all keys.
+	Prob   float64       // Probability to inject if matched. Default 1.
+	From   time.Duration // The rule is active since From after the script started.
+	To     time.Duration // The rule is active until To after the script started, 0 for no end.
+	Delay  time.Duration // The latency of spikes, or the time before timeout.
+	Ratio  float64       // The ratio of bytes kept on truncating.
+}
+
+// ParseFaultRule parses a rule like "truncate op=get prefix=abc p=0.1 from=10m to=20m ratio=0.5".
+func ParseFaultRule(spec string) (*FaultRule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, ErrInvalidFault
+	}
+
+	rule := &FaultRule{Kind: strings.ToLower(fields[0]), Prob: 1, Ratio: 0.5}
+	valid := false
+	for _, kind := range faultKinds {
+		valid = valid || kind == rule.Kind
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w, unknown kind: %s", ErrInvalidFault, fields[0])
+	}
+
+	var err error
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) < 2 {
+			return nil, fmt.Errorf("%w, expecting key=value: %s", ErrInvalidFault, field)
+		}
+		switch strings.ToLower(kv[0]) {
+		case "op":
+			rule.Op = strings.ToLower(kv[1])
+		case "prefix":
+			rule.Prefix = kv[1]
+		case "p":
+			rule.Prob, err = strconv.ParseFloat(kv[1], 64)
+		case "from":
+			rule.From, err = time.ParseDuration(kv[1])
+		case "to":
+			rule.To, err = time.ParseDuration(kv[1])
+		case "delay":
+			rule.Delay, err = time.ParseDuration(kv[1])
+		case "ratio":
+			rule.Ratio, err = strconv.ParseFloat(kv[1], 64)
+		default:
+			return nil, fmt.Errorf("%w, unknown option: %s", ErrInvalidFault, field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w, %s: %v", ErrInvalidFault, field, err)
+		}
+	}
+	return rule, nil
+}
+
+func (r *FaultRule) match(op string, key string, elapsed time.Duration) bool {
+	return (r.Op == "" || r.Op == op) &&
+		strings.HasPrefix(key, r.Prefix) &&
+		elapsed >= r.From && (r.To == 0 || elapsed < r.To) &&
+		(r.Prob >= 1 || rand.Float64() < r.Prob)
+}
+
+// FaultScript A set of fault rules shared by Faulty clients. Rules are scheduled relative to the time the script started.
+type FaultScript struct {
+	Rules []*FaultRule
+
+	start    time.Time
+	once     sync.Once
+	injected map[string]*int64
+}
+
+// NewFaultScript creates a script from a file of rules, one per line, or from rules separated by ';'.
+func NewFaultScript(spec string) (*FaultScript, error) {
+	var lines []string
+	if file, err := os.Open(spec); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		lines = strings.Split(spec, ";")
+	}
+
+	script := &FaultScript{injected: make(map[string]*int64, len(faultKinds))}
+	for _, kind := range faultKinds {
+		script.injected[kind] = new(int64)
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseFaultRule(line)
+		if err != nil {
+			return nil, err
+		}
+		script.Rules = append(script.Rules, rule)
+	}
+	return script, nil
+}
+
+// Start starts the schedule of rules. The schedule starts on the first request if not called.
+func (s *FaultScript) Start(start time.Time) {
+	s.once.Do(func() {
+		s.start = start
+	})
+}
+
+// Injected returns the number of faults injected by kind.
+func (s *FaultScript) Injected() map[string]int64 {
+	injected := make(map[string]int64, len(s.injected))
+	for kind, counter := range s.injected {
+		injected[kind] = atomic.LoadInt64(counter)
+	}
+	return injected
+}
+
+func (s *FaultScript) String() string {
+	injected := s.Injected()
+	kinds := make([]string, 0, len(injected))
+	for kind := range injected {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	msgs := make([]string, len(kinds))
+	for i, kind := range kinds {
+		msgs[i] = fmt.Sprintf("%s %d", kind, injected[kind])
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (s *FaultScript) match(op string, key string) *FaultRule {
+	s.Start(time.Now())
+	elapsed := time.Since(s.start)
+	for _, rule := range s.Rules {
+		if rule.match(op, key, elapsed) {
+			atomic.AddInt64(s.injected[rule.Kind], 1)
+			return rule
+		}
+	}
+	return nil
+}
+
+// Faulty A Client decorator injecting faults following the script.
+type Faulty struct {
+	Client
+	script *FaultScript
+}
+
+func NewFaulty(cli Client, script *FaultScript) *Faulty {
+	return &Faulty{Client: cli, script: script}
+}
+
+// FaultMiddleware returns the middleware injecting faults following the script.
+func FaultMiddleware(script *FaultScript) Middleware {
+	return func(cli Client) Client {
+		return NewFaulty(cli, script)
+	}
+}
+
+func (c *Faulty) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	return c.set(key, func() (string, error) {
+		return c.Client.EcSet(key, val, args...)
+	})
+}
+
+// EcSetReader ReaderSetter implementation, falls back to EcSet if not supported by the client decorated.
+func (c *Faulty) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	return c.set(key, func() (string, error) {
+		return setReader(c.Client, key, reader, args...)
+	})
+}
+
+func (c *Faulty) set(key string, setter func() (string, error)) (string, error) {
+	rule := c.script.match("set", key)
+	if rule == nil {
+		return setter()
+	}
+
+	start := time.Now()
+	var reqId string
+	var err error
+	if rule.Kind == FaultNotFound {
+		// Not found is not applicable to set, fails the request instead.
+		reqId, err = uuid.New().String(), ErrInjected
+	} else {
+		// Truncation is not applicable to set, and the request passes.
+		reqId, err = c.inject(rule, setter)
+	}
+	nanoLog(logFault, "set", reqId, key, start.UnixNano(), rule.Kind)
+	return reqId, err
+}
+
+func (c *Faulty) EcGet(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	rule := c.script.match("get", key)
+	if rule == nil {
+		return c.Client.EcGet(key, args...)
+	}
+
+	start := time.Now()
+	var reader sion.ReadAllCloser
+	reqId, err := c.inject(rule, func() (reqId string, err error) {
+		reqId, reader, err = c.Client.EcGet(key, args...)
+		if err == nil && reader != nil && rule.Kind == FaultTruncate {
+			reader = &truncatedReader{ReadAllCloser: reader, remain: int(float64(reader.Len()) * rule.Ratio)}
+		}
+		return
+	})
+	nanoLog(logFault, "get", reqId, key, start.UnixNano(), rule.Kind)
+	return reqId, reader, err
+}
+
+func (c *Faulty) inject(rule *FaultRule, pass func() (string, error)) (string, error) {
+	switch rule.Kind {
+	case FaultError:
+		return uuid.New().String(), ErrInjected
+	case FaultNotFound:
+		return uuid.New().String(), sion.ErrNotFound
+	case FaultTimeout:
+		time.Sleep(rule.Delay)
+		return uuid.New().String(), ErrInjectedTimeout
+	case FaultLatency:
+		time.Sleep(rule.Delay)
+		return pass()
+	default:
+		return pass()
+	}
+}
+
+// truncatedReader Ends the reader after remaining bytes are read.
+type truncatedReader struct {
+	sion.ReadAllCloser
+	remain int
+}
+
+func (r *truncatedReader) Len() int {
+	return r.remain
+}
+
+func (r *truncatedReader) Read(p []byte) (n int, err error) {
+	if r.remain <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err = r.ReadAllCloser.Read(p)
+	r.remain -= n
+	return
+}
+
+func (r *truncatedReader) ReadAll() ([]byte, error) {
+	buf := make([]byte, r.Len())
+	n, err := io.ReadFull(r, buf)
+	r.Close()
+	return buf[:n], err
+}
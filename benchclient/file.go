@@ -1,7 +1,7 @@
 package benchclient
 
 import (
-	"io/ioutil"
+	"io"
 	"os"
 	"path"
 
@@ -24,7 +24,7 @@ func NewFile(provider string, path string) *File {
 	return client
 }
 
-func (c *File) set(key string, val []byte) (err error) {
+func (c *File) set(key string, reader sion.ReadAllCloser) (err error) {
 	var file *os.File
 	file, err = os.OpenFile(path.Join(c.basePath, key), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
@@ -32,21 +32,23 @@ func (c *File) set(key string, val []byte) (err error) {
 	}
 	defer file.Close()
 
-	_, err = file.Write(val)
+	_, err = io.Copy(file, reader)
 	return
 }
 
 func (c *File) get(key string) (reader sion.ReadAllCloser, err error) {
 	var file *os.File
-	if file, err = os.OpenFile(path.Join(c.basePath, key), os.O_RDONLY, 0); err != nil {
+	if file, err = os.OpenFile(path.Join(c.basePath, key), os.O_RDONLY, 0); os.IsNotExist(err) {
+		return nil, sion.ErrNotFound
+	} else if err != nil {
 		return
 	}
-	defer file.Close()
 
-	var data []byte
-	if data, err = ioutil.ReadAll(file); err != nil {
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		file.Close()
 		return
 	}
 
-	return NewByteReader(data), nil
+	return NewStreamReader(file, int(info.Size())), nil
 }
@@ -0,0 +1,148 @@
+package benchclient
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	DefaultHedgePercentile = 95
+	DefaultHedgeMinSamples = 100
+)
+
+// HedgeOptions Options of hedged gets.
+type HedgeOptions struct {
+	// Delay The fixed delay before a hedged get is sent. If 0, the delay follows the Percentile of latencies observed.
+	Delay time.Duration
+
+	// Percentile The percentile of latencies observed as the delay. Default DefaultHedgePercentile.
+	Percentile float64
+
+	// MinSamples Gets are not hedged before the number of latencies observed. Default DefaultHedgeMinSamples.
+	MinSamples int64
+
+	// Acquire Acquires the client to send hedged gets. Clients must not be acquired from the pool of the client hedged.
+	Acquire func() Client
+
+	// Release Releases the client acquired.
+	Release func(Client)
+}
+
+// Hedged A Client decorator sending a second get if the first one is not responded after the delay.
+// The first response is taken. The client waits for the abandoned request to finish before it is reused.
+type Hedged struct {
+	Client
+	opts    HedgeOptions
+	stats   *MiddlewareStats
+	pending sync.WaitGroup
+}
+
+type hedgedResult struct {
+	reqId  string
+	reader sion.ReadAllCloser
+	err    error
+	hedged bool
+}
+
+func NewHedged(cli Client, opts HedgeOptions, stats *MiddlewareStats) *Hedged {
+	if opts.Percentile <= 0 {
+		opts.Percentile = DefaultHedgePercentile
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = DefaultHedgeMinSamples
+	}
+	return &Hedged{Client: cli, opts: opts, stats: stats}
+}
+
+// HedgeMiddleware returns the middleware hedging gets.
+func HedgeMiddleware(opts HedgeOptions, stats *MiddlewareStats) Middleware {
+	return func(cli Client) Client {
+		return NewHedged(cli, opts, stats)
+	}
+}
+
+func (c *Hedged) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	c.pending.Wait()
+	return c.Client.EcSet(key, val, args...)
+}
+
+// EcSetReader ReaderSetter implementation.
+func (c *Hedged) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	c.pending.Wait()
+	return setReader(c.Client, key, reader, args...)
+}
+
+func (c *Hedged) EcGet(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	c.pending.Wait()
+
+	delay, ok := c.delay()
+	if !ok {
+		start := time.Now()
+		reqId, reader, err := c.Client.EcGet(key, args...)
+		c.observe(start, err)
+		return reqId, reader, err
+	}
+
+	start := time.Now()
+	results := make(chan *hedgedResult, 2)
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		reqId, reader, err := c.Client.EcGet(key, args...)
+		results <- &hedgedResult{reqId: reqId, reader: reader, err: err}
+	}()
+
+	timer := time.NewTimer(delay)
+	select {
+	case ret := <-results:
+		timer.Stop()
+		c.observe(start, ret.err)
+		return ret.reqId, ret.reader, ret.err
+	case <-timer.C:
+	}
+
+	atomic.AddInt64(&c.stats.Hedges, 1)
+	go func() {
+		cli := c.opts.Acquire()
+		reqId, reader, err := cli.EcGet(key, args...)
+		c.opts.Release(cli)
+		results <- &hedgedResult{reqId: reqId, reader: reader, err: err, hedged: true}
+	}()
+
+	first := <-results
+	if first.hedged {
+		atomic.AddInt64(&c.stats.HedgeWins, 1)
+	}
+	c.observe(start, first.err)
+
+	// Abandon the slower one.
+	go func() {
+		abandoned := <-results
+		atomic.AddInt64(&c.stats.WastedRequests, 1)
+		if abandoned.reader != nil {
+			atomic.AddInt64(&c.stats.WastedBytes, int64(abandoned.reader.Len()))
+			abandoned.reader.Close()
+		}
+	}()
+	return first.reqId, first.reader, first.err
+}
+
+func (c *Hedged) delay() (time.Duration, bool) {
+	if c.opts.Acquire == nil {
+		return 0, false
+	} else if c.opts.Delay > 0 {
+		return c.opts.Delay, true
+	} else if c.stats.Latency.Count() < c.opts.MinSamples {
+		return 0, false
+	}
+	return c.stats.Latency.PercentileDuration(c.opts.Percentile), true
+}
+
+func (c *Hedged) observe(start time.Time, err error) {
+	if err == nil {
+		c.stats.Latency.RecordDuration(time.Since(start))
+	}
+}
@@ -0,0 +1,251 @@
+package benchclient
+
+import (
+	"encoding/json"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// histogramSubBits Values below 2^histogramSubBits are exact. Above, each power of 2 has histogramHalfCount linear
+	// sub-buckets, which keeps the relative error under 1/64 (about 1.6%). Bucket indexes are saved in snapshots, so
+	// changing the bits breaks snapshots saved.
+	histogramSubBits   = 7
+	histogramSubCount  = 1 << histogramSubBits
+	histogramHalfCount = histogramSubCount / 2
+)
+
+// Histogram An HDR-style histogram of non-negative int64 values, e.g. latencies in nanoseconds.
+// Buckets are linear within each power of 2, so percentiles are accurate to about 1.6% with a fixed footprint.
+// Histograms are thread-safe and can be merged.
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    float64
+	sumSq  float64
+	min    int64
+	max    int64
+	mu     sync.Mutex
+}
+
+// HistogramSnapshot The serializable form of a histogram. Buckets are sparse pairs of bucket index and count.
+type HistogramSnapshot struct {
+	Count   int64      `json:"count"`
+	Sum     float64    `json:"sum"`
+	SumSq   float64    `json:"sumsq"`
+	Min     int64      `json:"min"`
+	Max     int64      `json:"max"`
+	Buckets [][2]int64 `json:"buckets"`
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func histogramIndex(v int64) int {
+	if v < histogramSubCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histogramSubBits
+	return histogramSubCount + (shift-1)*histogramHalfCount + int(v>>shift) - histogramHalfCount
+}
+
+// histogramValue returns the highest value of the bucket.
+func histogramValue(idx int) int64 {
+	if idx < histogramSubCount {
+		return int64(idx)
+	}
+	shift := (idx-histogramSubCount)/histogramHalfCount + 1
+	mantissa := int64((idx-histogramSubCount)%histogramHalfCount + histogramHalfCount)
+	return (mantissa+1)<<shift - 1
+}
+
+// Record records a value. Negative values are recorded as 0.
+func (h *Histogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	idx := histogramIndex(v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += float64(v)
+	h.sumSq += float64(v) * float64(v)
+}
+
+func (h *Histogram) RecordDuration(d time.Duration) {
+	h.Record(int64(d))
+}
+
+// Merge adds all values recorded by the other histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	h.MergeSnapshot(other.Snapshot())
+}
+
+// MergeSnapshot adds all values in the snapshot, e.g. one loaded from the report of another run.
+func (h *Histogram) MergeSnapshot(snapshot *HistogramSnapshot) {
+	if snapshot == nil || snapshot.Count == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, bucket := range snapshot.Buckets {
+		idx := int(bucket[0])
+		if idx >= len(h.counts) {
+			counts := make([]int64, idx+1)
+			copy(counts, h.counts)
+			h.counts = counts
+		}
+		h.counts[idx] += bucket[1]
+	}
+	if h.total == 0 || snapshot.Min < h.min {
+		h.min = snapshot.Min
+	}
+	if snapshot.Max > h.max {
+		h.max = snapshot.Max
+	}
+	h.total += snapshot.Count
+	h.sum += snapshot.Sum
+	h.sumSq += snapshot.SumSq
+}
+
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.total
+}
+
+func (h *Histogram) Min() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.min
+}
+
+func (h *Histogram) Max() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.max
+}
+
+func (h *Histogram) Mean() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// StdDev returns the sample standard deviation.
+func (h *Histogram) StdDev() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total < 2 {
+		return 0
+	}
+	mean := h.sum / float64(h.total)
+	variance := (h.sumSq - float64(h.total)*mean*mean) / float64(h.total-1)
+	if variance < 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// Percentile returns the value at the percentile p in [0, 100], 0 if nothing recorded.
+func (h *Histogram) Percentile(p float64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := int64(0)
+	for idx, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			value := histogramValue(idx)
+			if value > h.max {
+				value = h.max
+			}
+			if value < h.min {
+				value = h.min
+			}
+			return value
+		}
+	}
+	return h.max
+}
+
+func (h *Histogram) PercentileDuration(p float64) time.Duration {
+	return time.Duration(h.Percentile(p))
+}
+
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := &HistogramSnapshot{
+		Count: h.total,
+		Sum:   h.sum,
+		SumSq: h.sumSq,
+		Min:   h.min,
+		Max:   h.max,
+	}
+	for idx, count := range h.counts {
+		if count > 0 {
+			snapshot.Buckets = append(snapshot.Buckets, [2]int64{int64(idx), count})
+		}
+	}
+	return snapshot
+}
+
+// Histogram restores the histogram from the snapshot.
+func (s *HistogramSnapshot) Histogram() *Histogram {
+	h := NewHistogram()
+	h.MergeSnapshot(s)
+	return h
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Snapshot())
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	snapshot := &HistogramSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.counts, h.total, h.sum, h.sumSq, h.min, h.max = nil, 0, 0, 0, 0, 0
+	h.mu.Unlock()
+	h.MergeSnapshot(snapshot)
+	return nil
+}
@@ -0,0 +1,166 @@
+package benchclient
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	// HTTPKeyPlaceholder The placeholder of keys in URL templates. Keys are appended to the path if not specified.
+	HTTPKeyPlaceholder = "{key}"
+)
+
+// NewHTTPTransport returns a transport keeping up to maxIdle connections alive per host, to be shared by HTTP clients.
+func NewHTTPTransport(maxIdle int) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdle
+	transport.MaxIdleConnsPerHost = maxIdle
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+// HTTP A generic client of HTTP object APIs. Objects are PUT to and GET from the URL template with the key filled.
+type HTTP struct {
+	*defaultClient
+	template string
+	client   *http.Client
+}
+
+// NewHTTP returns a client of the URL template, e.g. "http://localhost:8080/objects/{key}".
+// Share the transport among clients to pool connections, or nil to use the default transport.
+func NewHTTP(template string, transport http.RoundTripper) *HTTP {
+	if !strings.Contains(template, HTTPKeyPlaceholder) {
+		template = strings.TrimSuffix(template, "/") + "/" + HTTPKeyPlaceholder
+	}
+	client := &HTTP{
+		defaultClient: newDefaultClient("HTTP: "),
+		template:      template,
+		client:        &http.Client{Transport: transport},
+	}
+	client.setter = client.set
+	client.getter = client.get
+	client.abbr = "h"
+	return client
+}
+
+func (c *HTTP) url(key string) string {
+	return strings.ReplaceAll(c.template, HTTPKeyPlaceholder, url.PathEscape(key))
+}
+
+func (c *HTTP) set(key string, reader sion.ReadAllCloser) error {
+	req, err := http.NewRequest(http.MethodPut, c.url(key), reader)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(reader.Len())
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body to keep the connection alive.
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status of PUT %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (c *HTTP) get(key string) (sion.ReadAllCloser, error) {
+	resp, err := c.client.Get(c.url(key))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, sion.ErrNotFound
+	} else if resp.StatusCode/100 != 2 {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status of GET %s: %s", key, resp.Status)
+	} else if resp.ContentLength < 0 {
+		// Size unknown, buffer the body.
+		buf, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		return NewByteReader(buf), nil
+	}
+
+	return NewStreamReader(resp.Body, int(resp.ContentLength)), nil
+}
+
+const (
+	ProviderHTTP = "http"
+)
+
+func init() {
+	var template, serve string
+	var server *HTTPObjectServer
+	var once sync.Once
+	var startErr error
+	RegisterProvider(&Provider{
+		Name:        ProviderHTTP,
+		Description: "HTTP object API, enabled by -http or -httpServer",
+		RegisterFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&template, "http", "", "URL template of an HTTP object API for enable HTTP simulation, e.g. http://localhost:8080/objects/{key}. Keys are appended to the path if {key} is absent")
+			fs.StringVar(&serve, "httpServer", "", "start an in-process HTTP object server storing objects in memory (mem) or the directory specified. -http defaults to the server if not set")
+		},
+		Enabled: func() bool {
+			return template != "" || serve != ""
+		},
+		Factory: func(env *ProviderEnv) (ClientFactory, error) {
+			// The server is started once, errors are returned on every call.
+			once.Do(func() {
+				if serve == "" {
+					return
+				}
+				dir := serve
+				if dir == "mem" {
+					dir = ""
+				}
+				var served string
+				var err error
+				if server, err = NewHTTPObjectServer(dir); err == nil {
+					served, err = server.Listen("127.0.0.1:0")
+				}
+				if err != nil {
+					startErr = fmt.Errorf("failed to start the HTTP object server: %v", err)
+					return
+				}
+				log.Printf("HTTP object server started: %s", served)
+				if template == "" {
+					template = served
+				}
+			})
+			if startErr != nil {
+				return nil, startErr
+			}
+
+			transport := NewHTTPTransport(env.Concurrency)
+			return func() Client {
+				return NewHTTP(template, transport)
+			}, nil
+		},
+		Close: func() {
+			if server != nil {
+				server.Close()
+			}
+		},
+	})
+}
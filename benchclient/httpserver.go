@@ -0,0 +1,161 @@
+package benchclient
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HTTPObjectServer A minimal object server standing in for HTTP object APIs. Objects are PUT to, GET from and
+// DELETEd on /<key>, and kept in memory or in files of a directory.
+type HTTPObjectServer struct {
+	dir     string
+	objects map[string][]byte
+	mu      sync.RWMutex
+	server  *http.Server
+}
+
+// NewHTTPObjectServer returns a server storing objects in the directory, or in memory if dir is empty.
+func NewHTTPObjectServer(dir string) (*HTTPObjectServer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &HTTPObjectServer{dir: dir, objects: make(map[string][]byte)}, nil
+}
+
+// Listen serves on the address in background, e.g. "127.0.0.1:0", and returns the URL template of objects.
+func (s *HTTPObjectServer) Listen(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return fmt.Sprintf("http://%s/%s", listener.Addr(), HTTPKeyPlaceholder), nil
+}
+
+func (s *HTTPObjectServer) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *HTTPObjectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/"))
+	if err != nil || key == "" {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		err = s.put(key, r.Body)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodGet, http.MethodHead:
+		err = s.get(key, w, r.Method == http.MethodHead)
+	case http.MethodDelete:
+		err = s.del(key)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if os.IsNotExist(err) {
+		http.Error(w, "not found", http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *HTTPObjectServer) file(key string) string {
+	// Escaped keys are flat file names.
+	return path.Join(s.dir, url.PathEscape(key))
+}
+
+func (s *HTTPObjectServer) put(key string, body io.Reader) error {
+	if s.dir == "" {
+		buf, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.objects[key] = buf
+		s.mu.Unlock()
+		return nil
+	}
+
+	// Write to a temporary file and rename, so concurrent gets read whole objects.
+	tmp, err := os.CreateTemp(s.dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file(key))
+}
+
+func (s *HTTPObjectServer) get(key string, w http.ResponseWriter, headOnly bool) error {
+	if s.dir == "" {
+		s.mu.RLock()
+		buf, ok := s.objects[key]
+		s.mu.RUnlock()
+		if !ok {
+			return os.ErrNotExist
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		if !headOnly {
+			w.Write(buf)
+		}
+		return nil
+	}
+
+	file, err := os.Open(s.file(key))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if !headOnly {
+		io.Copy(w, file)
+	}
+	return nil
+}
+
+func (s *HTTPObjectServer) del(key string) error {
+	if s.dir == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.objects[key]; !ok {
+			return os.ErrNotExist
+		}
+		delete(s.objects, key)
+		return nil
+	}
+	return os.Remove(s.file(key))
+}
@@ -0,0 +1,197 @@
+package benchclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidLatencyModel = errors.New("invalid latency model, expecting constant:<d>, normal:<mean>,<stddev>, lognormal:<median>,<sigma> or empirical:<file>")
+	ErrEmptyEmpiricalCDF   = errors.New("empty empirical cdf")
+)
+
+// LatencyModel Samples the latency of a request, excluding the transfer time.
+type LatencyModel interface {
+	Sample() time.Duration
+}
+
+// ConstantLatency A fixed latency.
+type ConstantLatency time.Duration
+
+func (l ConstantLatency) Sample() time.Duration {
+	return time.Duration(l)
+}
+
+// NormalLatency Latency follows the normal distribution, negative samples are truncated to 0.
+type NormalLatency struct {
+	Mean   time.Duration
+	StdDev time.Duration
+}
+
+func (l *NormalLatency) Sample() time.Duration {
+	sample := time.Duration(rand.NormFloat64()*float64(l.StdDev)) + l.Mean
+	if sample < 0 {
+		return 0
+	}
+	return sample
+}
+
+// LogNormalLatency Latency follows the lognormal distribution, defined by the median and the sigma of the log.
+type LogNormalLatency struct {
+	Median time.Duration
+	Sigma  float64
+}
+
+func (l *LogNormalLatency) Sample() time.Duration {
+	return time.Duration(float64(l.Median) * math.Exp(rand.NormFloat64()*l.Sigma))
+}
+
+// EmpiricalLatency Latency follows an empirical cdf, interpolated linearly between points.
+type EmpiricalLatency struct {
+	latencies []time.Duration
+	cdf       []float64
+}
+
+// NewEmpiricalLatency loads the empirical cdf from a file. Each line of the file is either "latency,probability"
+// as points of the cdf, or "latency" as a sample. The latency can be a duration like 10ms or a float in milliseconds.
+func NewEmpiricalLatency(path string) (*EmpiricalLatency, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	model := &EmpiricalLatency{}
+	samples := true
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		latency, err := parseLatency(fields[0])
+		if err != nil {
+			// Skip header
+			continue
+		}
+		model.latencies = append(model.latencies, latency)
+		if len(fields) > 1 {
+			samples = false
+			prob, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid probability in %s: %s", path, line)
+			}
+			model.cdf = append(model.cdf, prob)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if len(model.latencies) == 0 {
+		return nil, ErrEmptyEmpiricalCDF
+	}
+
+	if samples {
+		sort.Slice(model.latencies, func(i, j int) bool { return model.latencies[i] < model.latencies[j] })
+		model.cdf = make([]float64, len(model.latencies))
+		for i := range model.cdf {
+			model.cdf[i] = float64(i+1) / float64(len(model.cdf))
+		}
+	} else if len(model.cdf) != len(model.latencies) {
+		return nil, fmt.Errorf("missing probabilities in %s", path)
+	}
+	return model, nil
+}
+
+func (l *EmpiricalLatency) Sample() time.Duration {
+	u := rand.Float64() * l.cdf[len(l.cdf)-1]
+	i := sort.SearchFloat64s(l.cdf, u)
+	if i == 0 {
+		return l.latencies[0]
+	} else if i >= len(l.cdf) {
+		return l.latencies[len(l.latencies)-1]
+	}
+
+	// Interpolate between points i-1 and i.
+	span := l.cdf[i] - l.cdf[i-1]
+	if span <= 0 {
+		return l.latencies[i]
+	}
+	ratio := (u - l.cdf[i-1]) / span
+	return l.latencies[i-1] + time.Duration(ratio*float64(l.latencies[i]-l.latencies[i-1]))
+}
+
+// ParseLatencyModel parses the latency model from specifications like:
+// constant:10ms, normal:10ms,2ms, lognormal:10ms,0.5, or empirical:latency.csv.
+// An empty specification returns nil.
+func ParseLatencyModel(spec string) (LatencyModel, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) < 2 {
+		return nil, ErrInvalidLatencyModel
+	}
+	params := strings.Split(parts[1], ",")
+	switch strings.ToLower(parts[0]) {
+	case "constant":
+		latency, err := parseLatency(params[0])
+		if err != nil {
+			return nil, err
+		}
+		return ConstantLatency(latency), nil
+	case "normal":
+		if len(params) < 2 {
+			return nil, ErrInvalidLatencyModel
+		}
+		mean, err := parseLatency(params[0])
+		if err != nil {
+			return nil, err
+		}
+		stddev, err := parseLatency(params[1])
+		if err != nil {
+			return nil, err
+		}
+		return &NormalLatency{Mean: mean, StdDev: stddev}, nil
+	case "lognormal":
+		if len(params) < 2 {
+			return nil, ErrInvalidLatencyModel
+		}
+		median, err := parseLatency(params[0])
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := strconv.ParseFloat(params[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		return &LogNormalLatency{Median: median, Sigma: sigma}, nil
+	case "empirical":
+		return NewEmpiricalLatency(parts[1])
+	default:
+		return nil, ErrInvalidLatencyModel
+	}
+}
+
+// parseLatency parses a duration like 10ms, or a float in milliseconds.
+func parseLatency(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,116 @@
+package benchclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Link A bandwidth pipe shared by clients. Transfers are served one after another at the full capacity,
+// like a token bucket without burst, so concurrent transfers queue behind each other.
+type Link struct {
+	Name     string
+	Capacity int64 // Capacity in B/s
+
+	free      time.Time // The time the link finishes all transfers scheduled.
+	started   time.Time
+	busy      time.Duration
+	queued    time.Duration
+	transfers int64
+	bytes     int64
+	mu        sync.Mutex
+}
+
+// LinkStats Counters of a link.
+type LinkStats struct {
+	Name      string
+	Capacity  int64
+	Transfers int64
+	Bytes     int64
+	Busy      time.Duration
+	Queued    time.Duration
+	Elapsed   time.Duration
+}
+
+// Utilization returns the ratio of time the link was busy.
+func (s LinkStats) Utilization() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Busy) / float64(s.Elapsed)
+}
+
+// QueueDelay returns the average time a transfer waited for the link.
+func (s LinkStats) QueueDelay() time.Duration {
+	if s.Transfers == 0 {
+		return 0
+	}
+	return s.Queued / time.Duration(s.Transfers)
+}
+
+func (s LinkStats) String() string {
+	return fmt.Sprintf("%s %s/s, transfers %d, %s moved, utilization %.2f%%, queuing delay %v(avg) %v(total)",
+		s.Name, humanize.IBytes(uint64(s.Capacity)), s.Transfers, humanize.Bytes(uint64(s.Bytes)), s.Utilization()*100, s.QueueDelay(), s.Queued)
+}
+
+func NewLink(name string, capacity int64) *Link {
+	return &Link{
+		Name:     name,
+		Capacity: capacity,
+	}
+}
+
+// Transfer blocks for the time to transfer size bytes over the link, including the time queued
+// behind transfers scheduled earlier. Returns the queuing delay.
+func (l *Link) Transfer(size int) time.Duration {
+	if l == nil || l.Capacity <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	service := time.Duration(float64(size) / float64(l.Capacity) * float64(time.Second))
+
+	l.mu.Lock()
+	if l.started.IsZero() {
+		l.started = now
+	}
+	start := l.free
+	if start.Before(now) {
+		start = now
+	}
+	l.free = start.Add(service)
+	end := l.free
+	l.busy += service
+	l.queued += start.Sub(now)
+	l.transfers++
+	l.bytes += int64(size)
+	l.mu.Unlock()
+
+	time.Sleep(end.Sub(now))
+	return start.Sub(now)
+}
+
+func (l *Link) Stats() LinkStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := LinkStats{
+		Name:      l.Name,
+		Capacity:  l.Capacity,
+		Transfers: l.transfers,
+		Bytes:     l.bytes,
+		Busy:      l.busy,
+		Queued:    l.queued,
+	}
+	if !l.started.IsZero() {
+		// Transfers scheduled are counted as busy, so count the time up to the end of transfers.
+		end := time.Now()
+		if l.free.After(end) {
+			end = l.free
+		}
+		stats.Elapsed = end.Sub(l.started)
+	}
+	return stats
+}
@@ -10,21 +10,38 @@ import (
 
 var (
 	logClient nanolog.Handle
+	logFault  nanolog.Handle
+	logMirror nanolog.Handle
 	nlogger   func(nanolog.Handle, ...interface{}) error
 )
 
 func init() {
-	// cmd, reqId, begin, duration, size, ret, client
-	logClient = nanolog.AddLogger("%s,%s,%i64,%i64,%i,%i,%s")
+	// cmd, key, begin, first byte, duration, size, ret, client
+	logClient = addLogger("client", "%s,%s,%i64,%i64,%i64,%i,%i,%s",
+		"cmd", "key", "begin", "firstByte", "duration", "size", "ret", "client")
+	// cmd, reqId, key, begin, fault
+	logFault = addLogger("fault", "%s,%s,%s,%i64,%s",
+		"cmd", "reqId", "key", "begin", "fault")
+	// cmd, reqId, key, primary duration, shadow duration, disagreement
+	logMirror = addLogger("mirror", "%s,%s,%s,%i64,%i64,%s",
+		"cmd", "reqId", "key", "primaryDuration", "shadowDuration", "disagreement")
+}
+
+// addLogger adds the nanolog handle and registers the schema for decoding.
+func addLogger(name string, format string, columns ...string) nanolog.Handle {
+	RegisterLogSchema(&LogSchema{Name: name, Format: format, Columns: columns})
+	return nanolog.AddLogger(format)
 }
 
 type logEntry struct {
-	Cmd      string
-	ReqId    string
-	Start    time.Time
-	Duration time.Duration
-	Size     int
-	Ret      int
+	Cmd       string
+	ReqId     string
+	Start     time.Time
+	FirstByte time.Duration
+	Duration  time.Duration
+	Size      int
+	Ret       int
+	Client    string
 }
 
 func (e *logEntry) Begin(reqId string) {
@@ -70,7 +87,7 @@ func nanoLog(handle nanolog.Handle, args ...interface{}) error {
 	if len(args) > 0 {
 		entry, ok := args[0].(*logEntry)
 		if ok {
-			return nlogger(handle, entry.Cmd, entry.ReqId, entry.Start.UnixNano(), entry.Duration.Nanoseconds(), entry.Size, entry.Ret)
+			return nlogger(handle, entry.Cmd, entry.ReqId, entry.Start.UnixNano(), entry.FirstByte.Nanoseconds(), entry.Duration.Nanoseconds(), entry.Size, entry.Ret, entry.Client)
 		}
 	}
 	return nlogger(handle, args...)
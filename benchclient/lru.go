@@ -0,0 +1,121 @@
+package benchclient
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU A thread-safe LRU cache bounded by the total size of entries in bytes.
+type LRU struct {
+	Capacity int64
+
+	size    int64
+	entries map[string]*list.Element
+	order   *list.List // Front is the most recently used.
+	mu      sync.Mutex
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type lruEntry struct {
+	key   string
+	size  int64
+	value interface{}
+}
+
+// LRUStats Counters of an LRU.
+type LRUStats struct {
+	Capacity  int64
+	Size      int64
+	Entries   int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// MissRatio returns misses / (hits + misses), 0 if nothing was looked up.
+func (s LRUStats) MissRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Misses) / float64(s.Hits+s.Misses)
+}
+
+func NewLRU(capacity int64) *LRU {
+	return &LRU{
+		Capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value and size of the key, and marks the key as the most recently used.
+func (c *LRU) Get(key string) (interface{}, int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, 0, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(elem)
+	entry := elem.Value.(*lruEntry)
+	return entry.value, entry.size, true
+}
+
+// Add inserts or updates the key, evicting the least recently used entries if capacity is exceeded.
+// Entries larger than the capacity are not cached. Returns if the entry is cached.
+func (c *LRU) Add(key string, size int64, value interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if size > c.Capacity {
+		return false
+	}
+
+	for c.size+size > c.Capacity {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, size: size, value: value})
+	c.size += size
+	return true
+}
+
+// Remove deletes the key if exists.
+func (c *LRU) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *LRU) Stats() LRUStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return LRUStats{
+		Capacity:  c.Capacity,
+		Size:      c.size,
+		Entries:   len(c.entries),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
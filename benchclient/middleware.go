@@ -0,0 +1,84 @@
+package benchclient
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dustin/go-humanize"
+	sion "github.com/sionreview/sion/client"
+)
+
+// Middleware Decorates a client with additional behaviors.
+type Middleware func(Client) Client
+
+// Chain decorates the client with middlewares. The first middleware is the innermost one.
+func Chain(cli Client, middlewares ...Middleware) Client {
+	for _, middleware := range middlewares {
+		cli = middleware(cli)
+	}
+	return cli
+}
+
+// Rewinder Readers that can be read again from the beginning.
+type Rewinder interface {
+	Rewind()
+}
+
+// MiddlewareStats Counters of retries and hedges, shared by clients of a provider.
+type MiddlewareStats struct {
+	Retries        int64 // Attempts made after the first attempt.
+	Recovered      int64 // Requests succeeded after retrying.
+	Exhausted      int64 // Requests failed after all attempts.
+	Hedges         int64 // Hedged requests sent.
+	HedgeWins      int64 // Hedged requests responded before the original ones.
+	WastedRequests int64 // Failed attempts and responses abandoned.
+	WastedBytes    int64 // Bytes of responses abandoned.
+
+	// Latency Latencies of gets, used to decide the hedging threshold.
+	Latency *Histogram
+}
+
+func NewMiddlewareStats() *MiddlewareStats {
+	return &MiddlewareStats{Latency: NewHistogram()}
+}
+
+func (s *MiddlewareStats) String() string {
+	return fmt.Sprintf("retries %d (recovered %d, exhausted %d), hedges %d (won %d), wasted requests %d, wasted bytes %s",
+		atomic.LoadInt64(&s.Retries), atomic.LoadInt64(&s.Recovered), atomic.LoadInt64(&s.Exhausted),
+		atomic.LoadInt64(&s.Hedges), atomic.LoadInt64(&s.HedgeWins),
+		atomic.LoadInt64(&s.WastedRequests), humanize.Bytes(uint64(atomic.LoadInt64(&s.WastedBytes))))
+}
+
+// setReader uploads the reader using EcSetReader if supported by the client, or EcSet otherwise.
+func setReader(cli Client, key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	if setter, ok := cli.(ReaderSetter); ok {
+		return setter.EcSetReader(key, reader, args...)
+	}
+	val, err := reader.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	return cli.EcSet(key, val, args...)
+}
+
+// duplicateReader returns the reader to replace the reader, and a duplicate that can be read independently, so the
+// object can be written twice. Readers other than Cloners and Rewinders are read into memory. The duplicate is nil if
+// the reader can not be read, e.g. the bytes were discarded.
+func duplicateReader(reader sion.ReadAllCloser) (sion.ReadAllCloser, sion.ReadAllCloser) {
+	if reader == nil {
+		return nil, nil
+	} else if cloner, ok := reader.(Cloner); ok {
+		return reader, cloner.Clone()
+	}
+
+	val, err := reader.ReadAll()
+	if rewinder, ok := reader.(Rewinder); ok {
+		rewinder.Rewind()
+	} else if err == nil {
+		reader = NewByteReader(val)
+	}
+	if err != nil {
+		return reader, nil
+	}
+	return reader, NewByteReader(val)
+}
@@ -0,0 +1,269 @@
+package benchclient
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	MirrorAgreed      = ""
+	MirrorHitMiss     = "hitmiss"  // One found the object, the other did not.
+	MirrorSizeDiffers = "size"     // Both found the object of different sizes.
+	MirrorError       = "error"    // One failed, the other did not.
+	MirrorBothFailed  = "bothfail" // Both failed, not counted as a disagreement.
+)
+
+// MirrorOpStats Paired latencies of an operation on the primary and the shadow.
+type MirrorOpStats struct {
+	Primary *Histogram
+	Shadow  *Histogram
+	Slower  *Histogram // Shadow latency minus primary latency if the shadow was slower.
+	Faster  *Histogram // Primary latency minus shadow latency if the shadow was faster.
+
+	disagreements map[string]*int64
+}
+
+func newMirrorOpStats() *MirrorOpStats {
+	stats := &MirrorOpStats{
+		Primary:       NewHistogram(),
+		Shadow:        NewHistogram(),
+		Slower:        NewHistogram(),
+		Faster:        NewHistogram(),
+		disagreements: make(map[string]*int64),
+	}
+	for _, kind := range []string{MirrorHitMiss, MirrorSizeDiffers, MirrorError, MirrorBothFailed} {
+		stats.disagreements[kind] = new(int64)
+	}
+	return stats
+}
+
+// Pairs returns the number of latency pairs recorded.
+func (s *MirrorOpStats) Pairs() int64 {
+	return s.Slower.Count() + s.Faster.Count()
+}
+
+// Disagreements returns the number of requests by kind of disagreement.
+func (s *MirrorOpStats) Disagreements() map[string]int64 {
+	ret := make(map[string]int64, len(s.disagreements))
+	for kind, counter := range s.disagreements {
+		ret[kind] = atomic.LoadInt64(counter)
+	}
+	return ret
+}
+
+// DiffPercentile returns the percentile p in [0, 100] of paired differences, shadow latency minus primary latency.
+func (s *MirrorOpStats) DiffPercentile(p float64) time.Duration {
+	faster, slower := s.Faster.Count(), s.Slower.Count()
+	total := faster + slower
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank <= faster {
+		// Differences are negative, the most negative first.
+		return -s.Faster.PercentileDuration(float64(faster-rank+1) / float64(faster) * 100)
+	}
+	return s.Slower.PercentileDuration(float64(rank-faster) / float64(slower) * 100)
+}
+
+func (s *MirrorOpStats) record(primary, shadow time.Duration, primaryErr, shadowErr error) {
+	if primaryErr == nil {
+		s.Primary.RecordDuration(primary)
+	}
+	if shadowErr == nil {
+		s.Shadow.RecordDuration(shadow)
+	}
+	if primaryErr != nil || shadowErr != nil {
+		return
+	}
+	if shadow >= primary {
+		s.Slower.RecordDuration(shadow - primary)
+	} else {
+		s.Faster.RecordDuration(primary - shadow)
+	}
+}
+
+// MirrorStats Stats of mirrored requests by operation, shared by mirror clients. Shadow requests pending are tracked
+// here, so that the primary is never blocked by the shadow.
+type MirrorStats struct {
+	Primary string
+	Shadow  string
+	Ops     map[string]*MirrorOpStats
+
+	pending sync.WaitGroup
+}
+
+func NewMirrorStats(primary string, shadow string) *MirrorStats {
+	return &MirrorStats{
+		Primary: primary,
+		Shadow:  shadow,
+		Ops:     map[string]*MirrorOpStats{"get": newMirrorOpStats(), "set": newMirrorOpStats()},
+	}
+}
+
+// Wait waits for pending shadow requests and comparisons.
+func (s *MirrorStats) Wait() {
+	s.pending.Wait()
+}
+
+func (s *MirrorStats) String() string {
+	ops := make([]string, 0, len(s.Ops))
+	for op := range s.Ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	var msgs []string
+	for _, op := range ops {
+		stats := s.Ops[op]
+		disagreements := stats.Disagreements()
+		msgs = append(msgs, fmt.Sprintf("%s: %s p50/p90/p99 %v/%v/%v, %s p50/p90/p99 %v/%v/%v, %s-%s p1/p10/p50/p90/p99 %v/%v/%v/%v/%v of %d pairs, disagreements: hit/miss %d, size %d, error %d, both failed %d",
+			op,
+			s.Primary, stats.Primary.PercentileDuration(50), stats.Primary.PercentileDuration(90), stats.Primary.PercentileDuration(99),
+			s.Shadow, stats.Shadow.PercentileDuration(50), stats.Shadow.PercentileDuration(90), stats.Shadow.PercentileDuration(99),
+			s.Shadow, s.Primary, stats.DiffPercentile(1), stats.DiffPercentile(10), stats.DiffPercentile(50), stats.DiffPercentile(90), stats.DiffPercentile(99),
+			stats.Pairs(),
+			disagreements[MirrorHitMiss], disagreements[MirrorSizeDiffers], disagreements[MirrorError], disagreements[MirrorBothFailed]))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// MirrorOptions Options of mirroring.
+type MirrorOptions struct {
+	// Acquire Acquires the client of the shadow.
+	Acquire func() Client
+
+	// Release Releases the client of the shadow.
+	Release func(Client)
+}
+
+// Mirror A Client decorator sending every request to the shadow as well. Responses of the client decorated are
+// returned without waiting for the shadow. Latency pairs and disagreements are recorded after both responded.
+type Mirror struct {
+	Client
+	opts  MirrorOptions
+	stats *MirrorStats
+}
+
+type mirrorResult struct {
+	reqId    string
+	size     int
+	duration time.Duration
+	err      error
+}
+
+func NewMirror(cli Client, opts MirrorOptions, stats *MirrorStats) *Mirror {
+	return &Mirror{Client: cli, opts: opts, stats: stats}
+}
+
+// MirrorMiddleware returns the middleware mirroring requests to the shadow.
+func MirrorMiddleware(opts MirrorOptions, stats *MirrorStats) Middleware {
+	return func(cli Client) Client {
+		return NewMirror(cli, opts, stats)
+	}
+}
+
+func (c *Mirror) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	shadow := c.shadow(func(cli Client) (string, sion.ReadAllCloser, error) {
+		reqId, err := cli.EcSet(key, val, args...)
+		return reqId, nil, err
+	})
+	start := time.Now()
+	reqId, err := c.Client.EcSet(key, val, args...)
+	c.compare("set", key, &mirrorResult{reqId: reqId, duration: time.Since(start), err: err}, shadow)
+	return reqId, err
+}
+
+// EcSetReader ReaderSetter implementation. The shadow writes a duplicate of the reader, or is skipped if the reader
+// can not be duplicated.
+func (c *Mirror) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	reader, duplicated := duplicateReader(reader)
+	if duplicated == nil {
+		return setReader(c.Client, key, reader, args...)
+	}
+
+	shadow := c.shadow(func(cli Client) (string, sion.ReadAllCloser, error) {
+		reqId, err := setReader(cli, key, duplicated, args...)
+		return reqId, nil, err
+	})
+	start := time.Now()
+	reqId, err := setReader(c.Client, key, reader, args...)
+	c.compare("set", key, &mirrorResult{reqId: reqId, duration: time.Since(start), err: err}, shadow)
+	return reqId, err
+}
+
+func (c *Mirror) EcGet(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	shadow := c.shadow(func(cli Client) (string, sion.ReadAllCloser, error) {
+		return cli.EcGet(key, args...)
+	})
+	start := time.Now()
+	reqId, reader, err := c.Client.EcGet(key, args...)
+	primary := &mirrorResult{reqId: reqId, duration: time.Since(start), err: err, size: -1}
+	if reader != nil {
+		primary.size = reader.Len()
+	}
+	c.compare("get", key, primary, shadow)
+	return reqId, reader, err
+}
+
+// shadow sends the request to the shadow in background.
+func (c *Mirror) shadow(request func(Client) (string, sion.ReadAllCloser, error)) <-chan *mirrorResult {
+	ret := make(chan *mirrorResult, 1)
+	c.stats.pending.Add(1)
+	go func() {
+		defer c.stats.pending.Done()
+		cli := c.opts.Acquire()
+		defer c.opts.Release(cli)
+
+		start := time.Now()
+		reqId, reader, err := request(cli)
+		result := &mirrorResult{reqId: reqId, duration: time.Since(start), err: err, size: -1}
+		if reader != nil {
+			result.size = reader.Len()
+			reader.Close()
+		}
+		ret <- result
+	}()
+	return ret
+}
+
+// compare waits for the shadow in background and records the pair.
+func (c *Mirror) compare(op string, key string, primary *mirrorResult, shadow <-chan *mirrorResult) {
+	c.stats.pending.Add(1)
+	go func() {
+		defer c.stats.pending.Done()
+
+		result := <-shadow
+		stats := c.stats.Ops[op]
+		stats.record(primary.duration, result.duration, primary.err, result.err)
+
+		disagreement := MirrorAgreed
+		primaryMissed, shadowMissed := primary.err == sion.ErrNotFound, result.err == sion.ErrNotFound
+		primaryFailed, shadowFailed := primary.err != nil && !primaryMissed, result.err != nil && !shadowMissed
+		switch {
+		case primaryFailed && shadowFailed:
+			disagreement = MirrorBothFailed
+		case primaryFailed || shadowFailed:
+			disagreement = MirrorError
+		case primaryMissed != shadowMissed:
+			disagreement = MirrorHitMiss
+		case primary.size >= 0 && result.size >= 0 && primary.size != result.size:
+			// Sizes are unknown on dryrun.
+			disagreement = MirrorSizeDiffers
+		}
+		if disagreement != MirrorAgreed {
+			atomic.AddInt64(stats.disagreements[disagreement], 1)
+		}
+		nanoLog(logMirror, op, primary.reqId, key, primary.duration.Nanoseconds(), result.duration.Nanoseconds(), disagreement)
+	}()
+}
@@ -0,0 +1,130 @@
+package benchclient
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dustin/go-humanize"
+	"github.com/google/uuid"
+	sion "github.com/sionreview/sion/client"
+)
+
+// NearCacheOptions Options of the near cache.
+type NearCacheOptions struct {
+	// Cache The LRU shared by all clients of the process.
+	Cache *LRU
+
+	// SizesOnly Store sizes instead of objects, e.g. in lean mode.
+	SizesOnly bool
+}
+
+// NearCacheStats Counters of the near cache. Hits and misses are counted by the LRU.
+type NearCacheStats struct {
+	Cache      *LRU
+	BytesSaved int64
+}
+
+func (s *NearCacheStats) String() string {
+	stats := s.Cache.Stats()
+	return fmt.Sprintf("%s of %s, hits %d, misses %d, evictions %d, hit ratio %.2f%%, saved %s",
+		humanize.Bytes(uint64(stats.Size)), humanize.Bytes(uint64(stats.Capacity)), stats.Hits, stats.Misses, stats.Evictions,
+		(1-stats.MissRatio())*100, humanize.Bytes(uint64(atomic.LoadInt64(&s.BytesSaved))))
+}
+
+// NearCache A Client decorator serving recently read objects in the process. Objects read from the client decorated are
+// not cached until admitted by callers, see NearCacheOptions.Admit. Sets invalidate the object cached.
+type NearCache struct {
+	Client
+	opts  NearCacheOptions
+	stats *NearCacheStats
+}
+
+// nearCacheHit The reader of objects served by the near cache.
+type nearCacheHit struct {
+	sion.ReadAllCloser
+}
+
+// Checksum Checksummer implementation.
+func (r *nearCacheHit) Checksum() (uint64, bool) {
+	if summer, ok := r.ReadAllCloser.(Checksummer); ok {
+		return summer.Checksum()
+	}
+	return 0, false
+}
+
+func NewNearCache(cli Client, opts NearCacheOptions, stats *NearCacheStats) *NearCache {
+	return &NearCache{Client: cli, opts: opts, stats: stats}
+}
+
+// NearCacheMiddleware returns the middleware caching recently read objects.
+func NearCacheMiddleware(opts NearCacheOptions, stats *NearCacheStats) Middleware {
+	return func(cli Client) Client {
+		return NewNearCache(cli, opts, stats)
+	}
+}
+
+// IsNearCacheHit returns if the reader is served by the near cache.
+func IsNearCacheHit(reader sion.ReadAllCloser) bool {
+	_, ok := reader.(*nearCacheHit)
+	return ok
+}
+
+func (c *NearCache) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	c.opts.Cache.Remove(key)
+	return c.Client.EcSet(key, val, args...)
+}
+
+// EcSetReader ReaderSetter implementation.
+func (c *NearCache) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	c.opts.Cache.Remove(key)
+	return setReader(c.Client, key, reader, args...)
+}
+
+func (c *NearCache) EcGet(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	if val, size, ok := c.opts.Cache.Get(key); ok {
+		atomic.AddInt64(&c.stats.BytesSaved, size)
+		reqId := uuid.New().String()
+		switch cached := val.(type) {
+		case []byte:
+			return reqId, &nearCacheHit{NewByteReader(cached)}, nil
+		case *drainedReader:
+			drained := *cached
+			return reqId, &nearCacheHit{&drained}, nil
+		default:
+			return reqId, &nearCacheHit{&drainedReader{size: int(size)}}, nil
+		}
+	}
+
+	return c.Client.EcGet(key, args...)
+}
+
+// Admit caches the object read from the backend after the hit is validated, and returns the reader replacing the
+// reader to read the object. Nothing is cached if the reader is nil, e.g. on dryrun.
+func (o *NearCacheOptions) Admit(key string, reader sion.ReadAllCloser) (sion.ReadAllCloser, error) {
+	if reader == nil || IsNearCacheHit(reader) {
+		return reader, nil
+	}
+
+	size := int64(reader.Len())
+	if o.SizesOnly {
+		o.Cache.Add(key, size, nil)
+		return reader, nil
+	}
+
+	buf, err := reader.ReadAll()
+	if err == ErrNotSupported {
+		// Bytes discarded, keep the checksum if available.
+		if drained, ok := reader.(*drainedReader); ok {
+			o.Cache.Add(key, size, drained)
+		} else {
+			o.Cache.Add(key, size, nil)
+		}
+		return reader, nil
+	} else if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	reader.Close()
+	o.Cache.Add(key, int64(len(buf)), buf)
+	return NewByteReader(buf), nil
+}
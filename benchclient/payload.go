@@ -0,0 +1,123 @@
+package benchclient
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/cespare/xxhash"
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	payloadGamma = 0x9e3779b97f4a7c15 // Golden ratio increment of splitmix64.
+)
+
+// ReaderSetter Clients that can upload an object from a stream.
+type ReaderSetter interface {
+	EcSetReader(string, sion.ReadAllCloser, ...interface{}) (string, error)
+}
+
+// Payload A ReadAllCloser generating deterministic bytes keyed by object key, version and size.
+// The same key, version and size always generate the same bytes, so a payload can be regenerated instead of stored.
+type Payload struct {
+	key     string
+	version uint32
+	size    int
+	seed    uint64
+	read    int
+}
+
+func NewPayload(key string, size int) *Payload {
+	return NewVersionedPayload(key, 0, size)
+}
+
+func NewVersionedPayload(key string, version uint32, size int) *Payload {
+	return &Payload{
+		key:     key,
+		version: version,
+		size:    size,
+		seed:    xxhash.Sum64String(key) ^ uint64(size)*payloadGamma ^ uint64(version)<<32,
+	}
+}
+
+func (p *Payload) Key() string {
+	return p.key
+}
+
+func (p *Payload) Version() uint32 {
+	return p.version
+}
+
+func (p *Payload) Size() int {
+	return p.size
+}
+
+// Read io.Reader implementation
+func (p *Payload) Read(buf []byte) (n int, err error) {
+	if p.read >= p.size {
+		return 0, io.EOF
+	}
+	if len(buf) > p.Len() {
+		buf = buf[:p.Len()]
+	}
+
+	var word [8]byte
+	for n < len(buf) {
+		pos := p.read + n
+		binary.LittleEndian.PutUint64(word[:], p.word(uint64(pos/8)))
+		n += copy(buf[n:], word[pos%8:])
+	}
+	p.read += n
+	return n, nil
+}
+
+// Len ReaderAllCloser implementation
+func (p *Payload) Len() int {
+	return p.size - p.read
+}
+
+// ReadAll ReaderAllCloser implementation
+func (p *Payload) ReadAll() ([]byte, error) {
+	buf := make([]byte, p.Len())
+	_, err := io.ReadFull(p, buf)
+	return buf, err
+}
+
+// Close ReaderAllCloser implementation
+func (p *Payload) Close() error {
+	return nil
+}
+
+// Rewind resets the payload to regenerate from the first byte.
+func (p *Payload) Rewind() {
+	p.read = 0
+}
+
+// Clone returns a payload of the same version that reads from the first byte.
+func (p *Payload) Clone() sion.ReadAllCloser {
+	return NewVersionedPayload(p.key, p.version, p.size)
+}
+
+// Checksum returns the checksum of the whole payload. The read position is not affected.
+func (p *Payload) Checksum() uint64 {
+	digest := xxhash.New()
+	io.Copy(digest, &Payload{key: p.key, version: p.version, size: p.size, seed: p.seed})
+	return digest.Sum64()
+}
+
+// word generates the nth 8 bytes of the payload using splitmix64, so any position can be generated independently.
+func (p *Payload) word(n uint64) uint64 {
+	z := p.seed + (n+1)*payloadGamma
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// EcSetPayload uploads the payload as a stream if supported by the client, or as bytes otherwise.
+// A nil payload uploads nothing but the key, which is used in lean mode.
+func EcSetPayload(cli Client, key string, payload *Payload, args ...interface{}) (string, error) {
+	if payload == nil {
+		return cli.EcSet(key, nil, args...)
+	}
+	return setReader(cli, key, payload, args...)
+}
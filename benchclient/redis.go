@@ -2,18 +2,28 @@ package benchclient
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	sion "github.com/sionreview/sion/client"
 )
 
+const (
+	RedisReadWindow  = 4 * 1024 * 1024 // 4 MB per GETRANGE on streaming
+	RedisWriteWindow = 4 * 1024 * 1024 // 4 MB per APPEND on streaming
+)
+
 func GenRedisClusterSlotsProviderByAddresses(addrs []string, numSlots int) RedisClusterSlotsProvider {
 	var cached []redis.ClusterSlot
 	return func(ctx context.Context) ([]redis.ClusterSlot, error) {
 		if cached != nil {
+			recordRedisTopology(RedisTopologySynthesized, "", cached)
 			return cached, nil
 		}
 
@@ -40,16 +50,22 @@ func GenRedisClusterSlotsProviderByAddresses(addrs []string, numSlots int) Redis
 		}
 		cached = slots
 		log.Printf("Confirmed redis cluster slots: %v", cached)
+		recordRedisTopology(RedisTopologySynthesized, "", cached)
 		return cached, nil
 	}
 }
 
 func GenElasticCacheClusterSlotsProvider(addrPattern string, nodes int, numSlots int) RedisClusterSlotsProvider {
+	return GenRedisClusterSlotsProviderByAddresses(ElasticCacheAddresses(addrPattern, nodes), numSlots)
+}
+
+// ElasticCacheAddresses formats addresses of nodes from the pattern, with node index starting from 1.
+func ElasticCacheAddresses(addrPattern string, nodes int) []string {
 	addrs := make([]string, nodes)
 	for i := 0; i < nodes; i++ {
 		addrs[i] = fmt.Sprintf(addrPattern, i+1)
 	}
-	return GenRedisClusterSlotsProviderByAddresses(addrs, numSlots)
+	return addrs
 }
 
 type RedisClusterSlotsProvider func(context.Context) ([]redis.ClusterSlot, error)
@@ -57,6 +73,9 @@ type RedisClusterSlotsProvider func(context.Context) ([]redis.ClusterSlot, error
 type Redis struct {
 	*defaultClient
 	backend redis.UniversalClient
+
+	// ChunkOptions Options to split values larger than the proto-max-bulk-len of Redis.
+	ChunkOptions RedisChunkOptions
 }
 
 func NewRedisWithBackend(backend redis.UniversalClient) *Redis {
@@ -68,9 +87,17 @@ func NewRedisWithBackend(backend redis.UniversalClient) *Redis {
 	client.setter = client.set
 	client.getter = client.get
 	client.abbr = "ec"
+	client.ChunkOptions.validate()
 	return client
 }
 
+// SetChunkOptions overrides options to split large values.
+func (r *Redis) SetChunkOptions(opts RedisChunkOptions) *Redis {
+	r.ChunkOptions = opts
+	r.ChunkOptions.validate()
+	return r
+}
+
 func NewRedis(addr string) *Redis {
 	backend := redis.NewClient(&redis.Options{
 		Addr:     addr,
@@ -95,19 +122,93 @@ func NewElasticCache(addrPattern string, nodes int, numSlots int) *Redis {
 	return NewRedisWithBackend(backend)
 }
 
-func (r *Redis) set(key string, val []byte) (err error) {
-	return r.backend.Set(context.Background(), key, val, 0).Err()
+// NewRedisClusterByDiscovery creates a cluster client following the topology discovered from seed addresses.
+// The even slot split of seed addresses is used if discovery fails.
+func NewRedisClusterByDiscovery(seeds []string, numSlots int) *Redis {
+	backend := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots:  GenRedisClusterSlotsProviderByDiscovery(seeds, GenRedisClusterSlotsProviderByAddresses(seeds, numSlots)),
+		RouteRandomly: true,
+	})
+	return NewRedisWithBackend(backend)
+}
+
+func (r *Redis) set(key string, reader sion.ReadAllCloser) (err error) {
+	ctx := context.Background()
+	if reader.Len() > r.ChunkOptions.Threshold {
+		return r.setChunked(key, reader, reader.Len())
+	} else if reader.Len() <= RedisWriteWindow {
+		val, err := reader.ReadAll()
+		if err != nil {
+			return err
+		}
+		return r.backend.Set(ctx, key, val, 0).Err()
+	}
+
+	// Stream to a temporary key in the same slot and rename it on completion,
+	// so readers never see a partial value.
+	tmpKey := fmt.Sprintf("{%s}.%s", redisHashTag(key), uuid.New().String())
+	buf := make([]byte, RedisWriteWindow)
+	for written := 0; ; {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			var cmdErr error
+			if written == 0 {
+				cmdErr = r.backend.Set(ctx, tmpKey, buf[:n], 0).Err()
+			} else {
+				cmdErr = r.backend.Append(ctx, tmpKey, string(buf[:n])).Err()
+			}
+			if cmdErr != nil {
+				r.backend.Del(ctx, tmpKey)
+				return cmdErr
+			}
+			written += n
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			r.backend.Del(ctx, tmpKey)
+			return err
+		}
+	}
+	return r.backend.Rename(ctx, tmpKey, key).Err()
 }
 
 func (r *Redis) get(key string) (sion.ReadAllCloser, error) {
-	val, err := r.backend.Get(context.Background(), key).Bytes()
-	if err == redis.Nil {
-		return nil, sion.ErrNotFound
-	} else if err != nil {
+	// Query existence, size and the first window in one round trip. STRLEN can not tell a missing key from an empty
+	// value.
+	ctx := context.Background()
+	var exists, strlen *redis.IntCmd
+	var getrange *redis.StringCmd
+	_, err := r.backend.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.Exists(ctx, key)
+		strlen = pipe.StrLen(ctx, key)
+		getrange = pipe.GetRange(ctx, key, 0, RedisReadWindow-1)
+		return nil
+	})
+	if err != nil {
 		return nil, err
-	} else {
-		return NewByteReader(val), nil
+	} else if exists.Val() == 0 {
+		return nil, sion.ErrNotFound
+	} else if strlen.Val() < RedisManifestMaxLen && strings.HasPrefix(getrange.Val(), RedisManifestPrefix) {
+		manifest, err := parseRedisManifest(getrange.Val())
+		if err != nil {
+			return nil, err
+		}
+		reader := &redisChunkedReader{
+			backend:  r.backend,
+			key:      key,
+			manifest: manifest,
+		}
+		return NewStreamReader(reader, manifest.Size), nil
 	}
+
+	reader := &redisRangeReader{
+		backend: r.backend,
+		key:     key,
+		size:    strlen.Val(),
+	}
+	reader.buffer([]byte(getrange.Val()))
+	return NewStreamReader(reader, int(reader.size)), nil
 }
 
 func (r *Redis) Close() {
@@ -116,3 +217,106 @@ func (r *Redis) Close() {
 		r.backend = nil
 	}
 }
+
+// redisRangeReader Reads a value window by window using GETRANGE.
+type redisRangeReader struct {
+	backend redis.UniversalClient
+	key     string
+	size    int64
+	offset  int64 // Offset of next window to request.
+	buf     []byte
+}
+
+func (r *redisRangeReader) buffer(buf []byte) {
+	r.buf = buf
+	r.offset += int64(len(buf))
+}
+
+func (r *redisRangeReader) Read(p []byte) (n int, err error) {
+	if len(r.buf) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+
+		val, err := r.backend.GetRange(context.Background(), r.key, r.offset, r.offset+RedisReadWindow-1).Bytes()
+		if err != nil {
+			return 0, err
+		} else if len(val) == 0 {
+			// The value was shrunk or deleted while streaming.
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.buffer(val)
+	}
+
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *redisRangeReader) Close() error {
+	r.buf = nil
+	return nil
+}
+
+const (
+	ProviderRedis = "redis"
+)
+
+func init() {
+	var addr string
+	var cluster int
+	var discover bool
+	var chunkOpts RedisChunkOptions
+	RegisterProvider(&Provider{
+		Name:        ProviderRedis,
+		Description: "Redis or ElastiCache, enabled by -redis",
+		RegisterFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&addr, "redis", "", "Redis address for enable Redis simulation")
+			fs.IntVar(&cluster, "redisCluster", 1, "The number of nodes in the redis cluster. Set larger than 1 to enable Redis cluster")
+			fs.BoolVar(&discover, "redisDiscover", false, "discover the topology of the redis cluster using CLUSTER SLOTS. -redis accepts comma separated seeds, or the address pattern if -redisCluster is set. The even slot split is used if discovery fails.")
+			fs.IntVar(&chunkOpts.Threshold, "redisChunkThreshold", RedisMaxBulkLen, "values larger than this size will be split into chunks on Redis")
+			fs.IntVar(&chunkOpts.Size, "redisChunkSize", RedisChunkSize, "max size of chunks on Redis, no larger than the threshold")
+			fs.IntVar(&chunkOpts.Pipeline, "redisPipeline", RedisChunkPipelineLen, "number of chunks written per pipeline on Redis, bounding the memory buffering chunks to -redisPipeline * -redisChunkSize")
+			fs.IntVar(&chunkOpts.Num, "redisChunks", 0, "number of chunks to split large values into on Redis, 0 for splitting by size")
+		},
+		Enabled: func() bool {
+			return addr != ""
+		},
+		Factory: func(env *ProviderEnv) (ClientFactory, error) {
+			if discover {
+				seeds := strings.Split(addr, ",")
+				if cluster > 1 {
+					seeds = ElasticCacheAddresses(addr, cluster)
+				}
+				return func() Client {
+					return NewRedisClusterByDiscovery(seeds, 0).SetChunkOptions(chunkOpts)
+				}, nil
+			} else if cluster > 1 {
+				return func() Client {
+					return NewElasticCache(addr, cluster, 0).SetChunkOptions(chunkOpts)
+				}, nil
+			} else {
+				return func() Client {
+					return NewRedis(addr).SetChunkOptions(chunkOpts)
+				}, nil
+			}
+		},
+		Report: func() []string {
+			if addr == "" || (cluster <= 1 && !discover) {
+				return nil
+			}
+			return []string{fmt.Sprintf("Redis topology: %v", RedisTopology())}
+		},
+	})
+}
+
+// redisHashTag Returns the part of the key that decides its cluster slot: the
+// content of the first non-empty {...} when present, or the whole key otherwise.
+func redisHashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
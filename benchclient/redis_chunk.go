@@ -0,0 +1,192 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	RedisMaxBulkLen       = 512 * 1024 * 1024 // Default proto-max-bulk-len of Redis.
+	RedisChunkSize        = 64 * 1024 * 1024  // Default max size of chunks.
+	RedisManifestPrefix   = "sion-chunked:"
+	RedisManifestMaxLen   = 256
+	RedisChunkPipelineLen = 4 // Default number of chunks written in one pipeline.
+)
+
+var (
+	ErrInvalidRedisManifest = errors.New("invalid manifest of chunked value")
+)
+
+// RedisChunkOptions Options to split large values into chunk keys.
+type RedisChunkOptions struct {
+	// Threshold Values larger than the threshold are split into chunks. Default RedisMaxBulkLen.
+	Threshold int
+
+	// Size Max size of a chunk. Default RedisChunkSize, or Threshold if smaller.
+	Size int
+
+	// Num Number of chunks to split into. More chunks will be used if a chunk would exceed Size. 0 to split by Size.
+	Num int
+
+	// Pipeline Number of chunks written in one pipeline, which bounds chunks buffered in flight to Pipeline * Size.
+	// Default RedisChunkPipelineLen.
+	Pipeline int
+}
+
+func (o *RedisChunkOptions) validate() {
+	if o.Threshold <= 0 {
+		o.Threshold = RedisMaxBulkLen
+	}
+	if o.Size <= 0 {
+		o.Size = RedisChunkSize
+	}
+	if o.Size > o.Threshold {
+		o.Size = o.Threshold
+	}
+	if o.Pipeline <= 0 {
+		o.Pipeline = RedisChunkPipelineLen
+	}
+}
+
+// chunkSize returns the size of chunks for a value of specified size.
+func (o *RedisChunkOptions) chunkSize(size int) int {
+	if o.Num <= 0 {
+		return o.Size
+	}
+	chunkSize := (size + o.Num - 1) / o.Num
+	if chunkSize > o.Size {
+		chunkSize = o.Size
+	}
+	return chunkSize
+}
+
+// redisManifest The value stored at the key of a chunked value: size, number of chunks, chunk size, and id of chunks.
+type redisManifest struct {
+	Size      int
+	Chunks    int
+	ChunkSize int
+	Id        string
+}
+
+func parseRedisManifest(val string) (*redisManifest, error) {
+	manifest := &redisManifest{}
+	_, err := fmt.Sscanf(strings.TrimPrefix(val, RedisManifestPrefix), "%d:%d:%d:%s", &manifest.Size, &manifest.Chunks, &manifest.ChunkSize, &manifest.Id)
+	if err != nil {
+		return nil, ErrInvalidRedisManifest
+	}
+	return manifest, nil
+}
+
+func (m *redisManifest) String() string {
+	return fmt.Sprintf("%s%d:%d:%d:%s", RedisManifestPrefix, m.Size, m.Chunks, m.ChunkSize, m.Id)
+}
+
+// ChunkKey returns the key of ith chunk. Chunk keys are not hash tagged, so that chunks spread over the cluster.
+func (m *redisManifest) ChunkKey(key string, i int) string {
+	return fmt.Sprintf("%s#%s#%d", key, m.Id, i)
+}
+
+// setChunked splits the value into chunk keys written in pipelines, then points the key to the chunks using a manifest.
+func (r *Redis) setChunked(key string, reader io.Reader, size int) error {
+	ctx := context.Background()
+	chunkSize := r.ChunkOptions.chunkSize(size)
+	manifest := &redisManifest{
+		Size:      size,
+		Chunks:    (size + chunkSize - 1) / chunkSize,
+		ChunkSize: chunkSize,
+		Id:        uuid.New().String(),
+	}
+
+	// Buffer up to a pipeline of chunks, buffers are reused after the pipeline is sent.
+	bufs := make([][]byte, r.ChunkOptions.Pipeline)
+	if len(bufs) > manifest.Chunks {
+		bufs = bufs[:manifest.Chunks]
+	}
+	for i := 0; i < manifest.Chunks; i += len(bufs) {
+		_, err := r.backend.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for j := 0; j < len(bufs) && i+j < manifest.Chunks; j++ {
+				if bufs[j] == nil {
+					bufs[j] = make([]byte, chunkSize)
+				}
+				n, err := io.ReadFull(reader, bufs[j])
+				if err != nil && err != io.ErrUnexpectedEOF {
+					return err
+				}
+				pipe.Set(ctx, manifest.ChunkKey(key, i+j), bufs[j][:n], 0)
+			}
+			return nil
+		})
+		if err != nil {
+			r.delChunks(key, manifest)
+			return err
+		}
+	}
+
+	// Switch to new chunks and clean up the chunks replaced.
+	old, _ := r.backend.GetRange(ctx, key, 0, RedisManifestMaxLen-1).Result()
+	if err := r.backend.Set(ctx, key, manifest.String(), 0).Err(); err != nil {
+		r.delChunks(key, manifest)
+		return err
+	}
+	if strings.HasPrefix(old, RedisManifestPrefix) {
+		if oldManifest, err := parseRedisManifest(old); err == nil && oldManifest.Id != manifest.Id {
+			r.delChunks(key, oldManifest)
+		}
+	}
+	return nil
+}
+
+func (r *Redis) delChunks(key string, manifest *redisManifest) {
+	ctx := context.Background()
+	r.backend.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < manifest.Chunks; i++ {
+			pipe.Del(ctx, manifest.ChunkKey(key, i))
+		}
+		return nil
+	})
+}
+
+// redisChunkedReader Reads chunks of a chunked value one by one.
+type redisChunkedReader struct {
+	backend  redis.UniversalClient
+	key      string
+	manifest *redisManifest
+	next     int
+	chunk    *redisRangeReader
+}
+
+func (r *redisChunkedReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.chunk != nil {
+			n, err = r.chunk.Read(p)
+			if err != io.EOF {
+				return n, err
+			}
+		}
+
+		if r.next >= r.manifest.Chunks {
+			return 0, io.EOF
+		}
+		size := r.manifest.ChunkSize
+		if r.next == r.manifest.Chunks-1 {
+			size = r.manifest.Size - r.manifest.ChunkSize*(r.manifest.Chunks-1)
+		}
+		r.chunk = &redisRangeReader{
+			backend: r.backend,
+			key:     r.manifest.ChunkKey(r.key, r.next),
+			size:    int64(size),
+		}
+		r.next++
+	}
+}
+
+func (r *redisChunkedReader) Close() error {
+	r.chunk = nil
+	return nil
+}
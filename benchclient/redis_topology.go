@@ -0,0 +1,120 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	RedisTopologySynthesized = "synthesized"
+	RedisTopologyDiscovered  = "discovered"
+)
+
+var (
+	ErrNoRedisSeeds = errors.New("no seed address to discover the redis cluster")
+
+	redisTopology   RedisTopologyInfo
+	redisTopologyMu sync.Mutex
+)
+
+// RedisTopologyInfo The latest topology of redis cluster applied.
+type RedisTopologyInfo struct {
+	Mode    string
+	Seed    string // The address the topology was discovered from.
+	Nodes   int
+	Ranges  int
+	Reloads int // Number of times the topology was loaded, including the initial load.
+}
+
+func (t RedisTopologyInfo) String() string {
+	if t.Mode == "" {
+		return "n/a"
+	} else if t.Mode == RedisTopologyDiscovered {
+		return fmt.Sprintf("%s from %s, %d nodes, %d slot ranges, %d loads", t.Mode, t.Seed, t.Nodes, t.Ranges, t.Reloads)
+	} else {
+		return fmt.Sprintf("%s, %d nodes, %d slot ranges, %d loads", t.Mode, t.Nodes, t.Ranges, t.Reloads)
+	}
+}
+
+// RedisTopology returns the latest topology of redis cluster applied by any client.
+func RedisTopology() RedisTopologyInfo {
+	redisTopologyMu.Lock()
+	defer redisTopologyMu.Unlock()
+
+	return redisTopology
+}
+
+func recordRedisTopology(mode string, seed string, slots []redis.ClusterSlot) {
+	nodes := make(map[string]bool)
+	for _, slot := range slots {
+		for _, node := range slot.Nodes {
+			nodes[node.Addr] = true
+		}
+	}
+
+	redisTopologyMu.Lock()
+	defer redisTopologyMu.Unlock()
+
+	redisTopology.Mode = mode
+	redisTopology.Seed = seed
+	redisTopology.Nodes = len(nodes)
+	redisTopology.Ranges = len(slots)
+	redisTopology.Reloads++
+}
+
+// GenRedisClusterSlotsProviderByDiscovery discovers the topology using CLUSTER SLOTS on seed addresses.
+// The provider is called again on MOVED redirections, so resharding is followed. Nodes discovered
+// are used as seeds afterward. If none of the seeds responds, the fallback provider is used if specified.
+func GenRedisClusterSlotsProviderByDiscovery(seeds []string, fallback RedisClusterSlotsProvider) RedisClusterSlotsProvider {
+	seeds = append([]string(nil), seeds...)
+	var mu sync.Mutex
+	return func(ctx context.Context) ([]redis.ClusterSlot, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		err := ErrNoRedisSeeds
+		for _, idx := range rand.Perm(len(seeds)) {
+			// Reloading is rare, use one-off connections.
+			addr := seeds[idx]
+			cli := redis.NewClient(&redis.Options{Addr: addr})
+			var slots []redis.ClusterSlot
+			slots, err = cli.ClusterSlots(ctx).Result()
+			cli.Close()
+			if err != nil {
+				continue
+			}
+
+			seeds = mergeRedisSeeds(seeds, slots)
+			recordRedisTopology(RedisTopologyDiscovered, addr, slots)
+			return slots, nil
+		}
+
+		if fallback == nil {
+			return nil, err
+		}
+		log.Printf("Failed to discover redis cluster slots, fallback to synthesized slots: %v", err)
+		return fallback(ctx)
+	}
+}
+
+func mergeRedisSeeds(seeds []string, slots []redis.ClusterSlot) []string {
+	known := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		known[seed] = true
+	}
+	for _, slot := range slots {
+		for _, node := range slot.Nodes {
+			if !known[node.Addr] {
+				known[node.Addr] = true
+				seeds = append(seeds, node.Addr)
+			}
+		}
+	}
+	return seeds
+}
@@ -0,0 +1,166 @@
+package benchclient
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ProviderRoleMain     = "main"
+	ProviderRoleFailover = "failover"
+	ProviderRoleMirror   = "mirror"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown provider")
+	ErrProviderDisabled = errors.New("provider not enabled")
+
+	providers   = make(map[string]*Provider)
+	providersMu sync.Mutex
+)
+
+// ProviderEnv Settings of the simulator passed to factories of providers.
+type ProviderEnv struct {
+	Role          string // One of ProviderRoleMain, ProviderRoleFailover, ProviderRoleMirror.
+	Failover      string // The name of the failover provider, empty if none.
+	AddrList      string
+	Concurrency   int
+	Bandwidth     int64 // Bandwidth of all shards in B/s, 0 for unlimited.
+	DataShards    int
+	ParityShards  int
+	MaxGoroutines int
+	Dryrun        bool
+	Lean          bool
+}
+
+// ClientFactory Creates clients of a provider.
+type ClientFactory func() Client
+
+// Provider A backend registered to the simulator.
+type Provider struct {
+	// Name The name used in flags like -failover, case-insensitive.
+	Name string
+
+	// Description One line description listed with valid choices.
+	Description string
+
+	// Dual The provider can be the failover of itself, e.g. a dummy cache in front of a dummy store.
+	Dual bool
+
+	// RegisterFlags Registers flags configuring the provider. Optional.
+	RegisterFlags func(*flag.FlagSet)
+
+	// Enabled Returns if the provider is enabled by flags. If nil, the provider is enabled only if selected.
+	Enabled func() bool
+
+	// Factory Returns the factory of clients playing the role in the env.
+	Factory func(env *ProviderEnv) (ClientFactory, error)
+
+	// Report Returns summary lines after replaying. Optional.
+	Report func() []string
+
+	// Close Releases resources of the provider, e.g. servers started. Optional.
+	Close func()
+}
+
+// RegisterProvider registers the provider, usually in init(). Registering a name twice panics.
+func RegisterProvider(p *Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	name := strings.ToLower(p.Name)
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("provider registered twice: %s", name))
+	}
+	providers[name] = p
+}
+
+// LookupProvider returns the provider of the name. The error lists valid choices if the name is unknown.
+func LookupProvider(name string) (*Provider, error) {
+	providersMu.Lock()
+	p, ok := providers[strings.ToLower(name)]
+	providersMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s, valid choices: %s", ErrUnknownProvider, name, strings.Join(ProviderNames(), ", "))
+	}
+	return p, nil
+}
+
+// ProviderNames returns sorted names of providers registered.
+func ProviderNames() []string {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Providers returns providers registered, sorted by name.
+func Providers() []*Provider {
+	names := ProviderNames()
+	ret := make([]*Provider, len(names))
+	for i, name := range names {
+		ret[i], _ = LookupProvider(name)
+	}
+	return ret
+}
+
+// EnabledProviders returns sorted names of providers enabled by flags.
+func EnabledProviders() []string {
+	var names []string
+	for _, p := range Providers() {
+		if p.Enabled != nil && p.Enabled() {
+			names = append(names, strings.ToLower(p.Name))
+		}
+	}
+	return names
+}
+
+// RegisterProviderFlags registers flags of all providers to the flag set.
+func RegisterProviderFlags(fs *flag.FlagSet) {
+	for _, p := range Providers() {
+		if p.RegisterFlags != nil {
+			p.RegisterFlags(fs)
+		}
+	}
+}
+
+// isFlagSet returns if the flag was set on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) {
+			set = set || f.Name == name
+		})
+	}
+	return set
+}
+
+// ProviderUsage returns the list of providers and descriptions.
+func ProviderUsage() string {
+	var lines []string
+	for _, p := range Providers() {
+		lines = append(lines, fmt.Sprintf("  %s\t%s", strings.ToLower(p.Name), p.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NewProviderFactory resolves the name and returns the factory of clients playing the role in the env.
+// The provider must be enabled by flags unless it has no Enabled function.
+func NewProviderFactory(name string, env *ProviderEnv) (ClientFactory, error) {
+	p, err := LookupProvider(name)
+	if err != nil {
+		return nil, err
+	} else if p.Enabled != nil && !p.Enabled() {
+		return nil, fmt.Errorf("%w: %s, enabled: %s", ErrProviderDisabled, name, strings.Join(EnabledProviders(), ", "))
+	}
+	return p.Factory(env)
+}
@@ -0,0 +1,112 @@
+package benchclient
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	DefaultRetryBackoff    = 50 * time.Millisecond
+	DefaultRetryMaxBackoff = 5 * time.Second
+)
+
+// RetryOptions Options of retrying with exponential backoff.
+type RetryOptions struct {
+	// Attempts Max attempts including the first one. Retry is disabled if not larger than 1.
+	Attempts int
+
+	// Backoff The backoff before the first retry, doubled for each retry. Default DefaultRetryBackoff.
+	Backoff time.Duration
+
+	// MaxBackoff The max backoff. Default DefaultRetryMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// Retry A Client decorator retrying failed requests with exponential backoff and full jitter.
+// ErrNotFound is not retried.
+type Retry struct {
+	Client
+	opts  RetryOptions
+	stats *MiddlewareStats
+}
+
+func NewRetry(cli Client, opts RetryOptions, stats *MiddlewareStats) *Retry {
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultRetryBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return &Retry{Client: cli, opts: opts, stats: stats}
+}
+
+// RetryMiddleware returns the middleware retrying failed requests.
+func RetryMiddleware(opts RetryOptions, stats *MiddlewareStats) Middleware {
+	return func(cli Client) Client {
+		return NewRetry(cli, opts, stats)
+	}
+}
+
+func (c *Retry) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	return c.retry(func() (string, error) {
+		return c.Client.EcSet(key, val, args...)
+	})
+}
+
+// EcSetReader ReaderSetter implementation. The request is retried only if the reader can be rewound.
+func (c *Retry) EcSetReader(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	rewinder, ok := reader.(Rewinder)
+	if !ok {
+		return setReader(c.Client, key, reader, args...)
+	}
+
+	attempted := false
+	return c.retry(func() (string, error) {
+		if attempted {
+			rewinder.Rewind()
+		}
+		attempted = true
+		return setReader(c.Client, key, reader, args...)
+	})
+}
+
+func (c *Retry) EcGet(key string, args ...interface{}) (reqId string, reader sion.ReadAllCloser, err error) {
+	reqId, err = c.retry(func() (string, error) {
+		var attemptReqId string
+		attemptReqId, reader, err = c.Client.EcGet(key, args...)
+		return attemptReqId, err
+	})
+	return
+}
+
+func (c *Retry) retry(attempt func() (string, error)) (reqId string, err error) {
+	backoff := c.opts.Backoff
+	for i := 0; ; i++ {
+		reqId, err = attempt()
+		if err == nil || err == sion.ErrNotFound {
+			if i > 0 {
+				atomic.AddInt64(&c.stats.Recovered, 1)
+			}
+			return
+		}
+
+		atomic.AddInt64(&c.stats.WastedRequests, 1)
+		if i+1 >= c.opts.Attempts {
+			if i > 0 {
+				atomic.AddInt64(&c.stats.Exhausted, 1)
+			}
+			return
+		}
+
+		// Full jitter
+		time.Sleep(time.Duration(rand.Int63n(int64(backoff)) + 1))
+		backoff *= 2
+		if backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+		atomic.AddInt64(&c.stats.Retries, 1)
+	}
+}
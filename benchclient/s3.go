@@ -1,9 +1,10 @@
 package benchclient
 
 import (
-	"bytes"
+	"flag"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -38,25 +39,50 @@ func NewS3(bk string) *S3 {
 	return client
 }
 
-func (c *S3) set(key string, val []byte) error {
-	// Upload the file to S3.
+func (c *S3) set(key string, reader sion.ReadAllCloser) error {
+	// Upload the file to S3. The uploader streams the body part by part.
 	_, err := c.uploader.Upload(&s3manager.UploadInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
-		Body:   bytes.NewReader(val),
+		Body:   reader,
 	})
 	return err
 }
 
 func (c *S3) get(key string) (sion.ReadAllCloser, error) {
-	buff := new(aws.WriteAtBuffer)
-	_, err := c.downloader.Download(buff, &s3.GetObjectInput{
+	// Stream the body instead of buffering the whole object with the downloader.
+	output, err := c.downloader.S3.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
 	})
-	if err != nil {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, sion.ErrNotFound
+	} else if err != nil {
 		return nil, err
 	} else {
-		return NewByteReader(buff.Bytes()), nil
+		return NewStreamReader(output.Body, int(aws.Int64Value(output.ContentLength))), nil
 	}
 }
+
+const (
+	ProviderS3 = "s3"
+)
+
+func init() {
+	var bucket string
+	RegisterProvider(&Provider{
+		Name:        ProviderS3,
+		Description: "AWS S3, enabled by -s3",
+		RegisterFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&bucket, "s3", "", "s3 bucket for enable s3 simulation")
+		},
+		Enabled: func() bool {
+			return bucket != ""
+		},
+		Factory: func(env *ProviderEnv) (ClientFactory, error) {
+			return func() Client {
+				return NewS3(bucket)
+			}, nil
+		},
+	})
+}
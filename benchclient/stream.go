@@ -0,0 +1,108 @@
+package benchclient
+
+import (
+	"io"
+	"time"
+
+	"github.com/cespare/xxhash"
+	sion "github.com/sionreview/sion/client"
+)
+
+var (
+	// DiscardReads Drain streamed objects and discard the bytes read. Set to false to retain data in memory.
+	DiscardReads = true
+
+	// ChecksumReads Checksum the bytes of streamed objects before discarding, see Digest().
+	ChecksumReads = false
+)
+
+// Checksummer Readers that know the checksum of the object read.
+type Checksummer interface {
+	// Checksum returns the checksum and if the checksum is available.
+	Checksum() (uint64, bool)
+}
+
+// Digest reads the reader to the end and returns the number of bytes read and the checksum.
+// If the reader was drained with the checksum collected, the checksum is returned without reading.
+func Digest(reader sion.ReadAllCloser) (int, uint64, error) {
+	if checksummer, ok := reader.(Checksummer); ok {
+		if sum, ok := checksummer.Checksum(); ok {
+			return reader.Len(), sum, nil
+		}
+	}
+
+	digest := xxhash.New()
+	n, err := io.Copy(digest, reader)
+	return int(n), digest.Sum64(), err
+}
+
+// StreamReader A ReadAllCloser that streams an object from the backend and tracks the arrival of the first byte.
+type StreamReader struct {
+	io.ReadCloser
+
+	size      int
+	read      int
+	firstByte time.Time
+}
+
+func NewStreamReader(rd io.ReadCloser, size int) *StreamReader {
+	return &StreamReader{
+		ReadCloser: rd,
+		size:       size,
+	}
+}
+
+// Read io.Reader implementation
+func (r *StreamReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if n > 0 && r.firstByte.IsZero() {
+		r.firstByte = time.Now()
+	}
+	r.read += n
+	return
+}
+
+// Len ReaderAllCloser implementation
+func (r *StreamReader) Len() int {
+	return r.size - r.read
+}
+
+// ReadAll ReaderAllCloser implementation
+func (r *StreamReader) ReadAll() (buf []byte, err error) {
+	buf = make([]byte, r.Len())
+	_, err = io.ReadFull(r, buf)
+	r.Close()
+	return
+}
+
+// FirstByte returns the time the first byte arrived, zero if nothing has been read.
+func (r *StreamReader) FirstByte() time.Time {
+	return r.firstByte
+}
+
+// drainedReader The placeholder returned after a stream has been drained and discarded.
+type drainedReader struct {
+	size       int
+	sum        uint64
+	summarized bool
+}
+
+func (r *drainedReader) Checksum() (uint64, bool) {
+	return r.sum, r.summarized
+}
+
+func (r *drainedReader) Len() int {
+	return r.size
+}
+
+func (r *drainedReader) Read(p []byte) (n int, err error) {
+	return 0, ErrNotSupported
+}
+
+func (r *drainedReader) ReadAll() ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func (r *drainedReader) Close() error {
+	return nil
+}
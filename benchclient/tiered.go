@@ -0,0 +1,264 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	sion "github.com/sionreview/sion/client"
+)
+
+const (
+	WriteThrough = "through" // Write to the origin and then the cache.
+	WriteAround  = "around"  // Write to the origin only, the cache is filled by read repairs.
+	WriteBack    = "back"    // Write to the cache, and to the origin asynchronously.
+)
+
+var (
+	ErrInvalidWritePolicy = errors.New("invalid write policy, expecting through, around or back")
+)
+
+// Cloner Readers that can be duplicated to be read independently.
+type Cloner interface {
+	Clone() sion.ReadAllCloser
+}
+
+// TierStats Counters and latencies of a tier.
+type TierStats struct {
+	Name         string
+	Gets         int64
+	Hits         int64
+	Misses       int64
+	GetErrors    int64
+	Sets         int64
+	SetErrors    int64
+	BytesRead    int64
+	BytesWritten int64
+	GetLatency   *Histogram
+	SetLatency   *Histogram
+}
+
+func NewTierStats(name string) *TierStats {
+	return &TierStats{
+		Name:       name,
+		GetLatency: NewHistogram(),
+		SetLatency: NewHistogram(),
+	}
+}
+
+func (s *TierStats) String() string {
+	return fmt.Sprintf("%s: gets %d (hits %d, misses %d, errors %d), sets %d (errors %d), read %s, written %s, get p50/p99 %v/%v, set p50/p99 %v/%v",
+		s.Name, atomic.LoadInt64(&s.Gets), atomic.LoadInt64(&s.Hits), atomic.LoadInt64(&s.Misses), atomic.LoadInt64(&s.GetErrors),
+		atomic.LoadInt64(&s.Sets), atomic.LoadInt64(&s.SetErrors),
+		humanize.Bytes(uint64(atomic.LoadInt64(&s.BytesRead))), humanize.Bytes(uint64(atomic.LoadInt64(&s.BytesWritten))),
+		s.GetLatency.PercentileDuration(50), s.GetLatency.PercentileDuration(99),
+		s.SetLatency.PercentileDuration(50), s.SetLatency.PercentileDuration(99))
+}
+
+// get gets the object from the tier. The result is validated before being counted if validate is set, and the reader is
+// closed if the result is turned into an error. Gets served by the near cache in front of the tier are neither
+// validated nor counted.
+func (s *TierStats) get(cli Client, key string, args []interface{}, validate GetValidator) (string, sion.ReadAllCloser, error) {
+	start := time.Now()
+	reqId, reader, err := cli.EcGet(key, args...)
+	if IsNearCacheHit(reader) {
+		return reqId, reader, err
+	}
+	duration := time.Since(start)
+	if validate != nil {
+		if err = validate(reader, err); err != nil && reader != nil {
+			reader.Close()
+			reader = nil
+		}
+	}
+	atomic.AddInt64(&s.Gets, 1)
+	switch err {
+	case nil:
+		atomic.AddInt64(&s.Hits, 1)
+		if reader != nil {
+			atomic.AddInt64(&s.BytesRead, int64(reader.Len()))
+		}
+		s.GetLatency.RecordDuration(duration)
+	case sion.ErrNotFound:
+		atomic.AddInt64(&s.Misses, 1)
+	default:
+		atomic.AddInt64(&s.GetErrors, 1)
+	}
+	return reqId, reader, err
+}
+
+func (s *TierStats) set(cli Client, key string, reader sion.ReadAllCloser, args []interface{}) (string, error) {
+	var reqId string
+	var err error
+	size := 0
+	start := time.Now()
+	if reader == nil {
+		reqId, err = cli.EcSet(key, nil, args...)
+	} else {
+		size = reader.Len()
+		reqId, err = setReader(cli, key, reader, args...)
+	}
+	atomic.AddInt64(&s.Sets, 1)
+	if err != nil {
+		atomic.AddInt64(&s.SetErrors, 1)
+	} else {
+		atomic.AddInt64(&s.BytesWritten, int64(size))
+		s.SetLatency.RecordDuration(time.Since(start))
+	}
+	return reqId, err
+}
+
+// TieredStats Counters of a cache tier and an origin tier, shared by tiered clients.
+type TieredStats struct {
+	Cache           *TierStats
+	Origin          *TierStats
+	Repairs         int64
+	WriteBackErrors int64
+
+	writeBacks sync.WaitGroup
+}
+
+func NewTieredStats(cache string, origin string) *TieredStats {
+	return &TieredStats{
+		Cache:  NewTierStats(cache),
+		Origin: NewTierStats(origin),
+	}
+}
+
+// Wait waits for pending write-backs.
+func (s *TieredStats) Wait() {
+	s.writeBacks.Wait()
+}
+
+func (s *TieredStats) String() string {
+	return fmt.Sprintf("%s\n%s\nrepairs %d, write-back errors %d",
+		s.Cache, s.Origin, atomic.LoadInt64(&s.Repairs), atomic.LoadInt64(&s.WriteBackErrors))
+}
+
+// TieredOptions Options of the tiered client.
+type TieredOptions struct {
+	// Policy The write policy: WriteThrough, WriteAround, or WriteBack.
+	Policy string
+
+	// ReadRepair Refill the cache on a miss served by the origin.
+	ReadRepair bool
+
+	// Acquire Acquires the client of the origin tier.
+	Acquire func() Client
+
+	// Release Releases the client of the origin tier.
+	Release func(Client)
+
+	// WriteBackFailed Called on failures of write-backs if set.
+	WriteBackFailed func(key string, err error)
+}
+
+// ValidateWritePolicy returns the normalized policy, or ErrInvalidWritePolicy.
+func ValidateWritePolicy(policy string) (string, error) {
+	switch policy {
+	case WriteThrough, WriteAround, WriteBack:
+		return policy, nil
+	case "":
+		return WriteBack, nil
+	default:
+		return "", ErrInvalidWritePolicy
+	}
+}
+
+// Tiered Composes a cache tier with an origin tier. Tiered is not a Client: callers manage each tier by step methods
+// (GetCache, GetOrigin, SetCache, SetOrigin), applying the write policy and read repairs.
+type Tiered struct {
+	cache Client
+	opts  TieredOptions
+	stats *TieredStats
+}
+
+// GetValidator Validates the result of a get before it is counted, and returns the error replacing the error of the
+// result, e.g. ErrNotFound for hits of objects evicted in simulations.
+type GetValidator func(reader sion.ReadAllCloser, err error) error
+
+func NewTiered(cache Client, opts TieredOptions, stats *TieredStats) *Tiered {
+	opts.Policy, _ = ValidateWritePolicy(opts.Policy)
+	return &Tiered{cache: cache, opts: opts, stats: stats}
+}
+
+// HasOrigin returns if the origin tier is available.
+func (t *Tiered) HasOrigin() bool {
+	return t.opts.Acquire != nil
+}
+
+func (t *Tiered) Policy() string {
+	return t.opts.Policy
+}
+
+func (t *Tiered) ReadRepair() bool {
+	return t.opts.ReadRepair
+}
+
+// GetCache gets the object from the cache tier.
+func (t *Tiered) GetCache(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	return t.stats.Cache.get(t.cache, key, args, nil)
+}
+
+// GetCacheValidated gets the object from the cache tier, with the result validated before being counted.
+func (t *Tiered) GetCacheValidated(key string, validate GetValidator, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	return t.stats.Cache.get(t.cache, key, args, validate)
+}
+
+// GetOrigin gets the object from the origin tier.
+func (t *Tiered) GetOrigin(key string, args ...interface{}) (string, sion.ReadAllCloser, error) {
+	if !t.HasOrigin() {
+		return "", nil, sion.ErrNotFound
+	}
+	cli := t.opts.Acquire()
+	defer t.opts.Release(cli)
+	return t.stats.Origin.get(cli, key, args, nil)
+}
+
+// SetCache sets the object to the cache tier. A nil reader sets the key only.
+func (t *Tiered) SetCache(key string, reader sion.ReadAllCloser, args ...interface{}) (string, error) {
+	return t.stats.Cache.set(t.cache, key, reader, args)
+}
+
+// SetOrigin sets the object to the origin tier. If async, the object is written back in background and errors are
+// counted as write-back errors. A reader to be written back must be a Cloner, or will be read into memory.
+func (t *Tiered) SetOrigin(key string, reader sion.ReadAllCloser, async bool, args ...interface{}) (string, error) {
+	if !t.HasOrigin() {
+		return "", nil
+	} else if !async {
+		cli := t.opts.Acquire()
+		defer t.opts.Release(cli)
+		return t.stats.Origin.set(cli, key, reader, args)
+	}
+
+	if reader != nil {
+		if cloner, ok := reader.(Cloner); ok {
+			reader = cloner.Clone()
+		} else if val, err := reader.ReadAll(); err != nil {
+			return "", err
+		} else {
+			reader = NewByteReader(val)
+		}
+	}
+	t.stats.writeBacks.Add(1)
+	go func() {
+		defer t.stats.writeBacks.Done()
+		cli := t.opts.Acquire()
+		defer t.opts.Release(cli)
+		if _, err := t.stats.Origin.set(cli, key, reader, args); err != nil {
+			atomic.AddInt64(&t.stats.WriteBackErrors, 1)
+			if t.opts.WriteBackFailed != nil {
+				t.opts.WriteBackFailed(key, err)
+			}
+		}
+	}()
+	return "", nil
+}
+
+// Repaired counts a repair done by callers using step methods.
+func (t *Tiered) Repaired() {
+	atomic.AddInt64(&t.stats.Repairs, 1)
+}
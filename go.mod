@@ -10,6 +10,7 @@ require (
 	github.com/dustin/go-humanize v1.0.0
 	github.com/go-redis/redis/v8 v8.11.4
 	github.com/google/uuid v1.2.0
+	github.com/klauspost/reedsolomon v1.9.12
 	github.com/mason-leap-lab/go-utils v1.3.2
 	github.com/sionreview/sion v0.0.0-20230112044554-795ebcc5fbf4
 	github.com/zhangjyr/hashmap v1.0.2
@@ -25,7 +26,6 @@ require (
 	github.com/jordwest/mock-conn v0.0.0-20180617021051-4896c6bd1641 // indirect
 	github.com/kelindar/binary v1.0.9 // indirect
 	github.com/klauspost/cpuid/v2 v2.0.2 // indirect
-	github.com/klauspost/reedsolomon v1.9.12 // indirect
 	github.com/mason-leap-lab/redeo v1.1.12 // indirect
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
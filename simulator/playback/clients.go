@@ -1,69 +1,146 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sionreview/sion/client"
 	"github.com/sionreview/sionreplayer/benchclient"
 )
 
 const (
-	ProviderS3      = "s3"
-	ProviderRedis   = "redis"
-	ProviderDummy   = "dummy"
 	ProviderDefault = "default"
 )
 
+func init() {
+	benchclient.RegisterProvider(&benchclient.Provider{
+		Name:        ProviderDefault,
+		Description: "SION, the main service if no other service is enabled",
+		Factory: func(env *benchclient.ProviderEnv) (benchclient.ClientFactory, error) {
+			addrArr := strings.Split(env.AddrList, ",")
+			return func() benchclient.Client {
+				cli := client.NewClient(env.DataShards, env.ParityShards, env.MaxGoroutines)
+				if !env.Dryrun {
+					cli.Dial(addrArr)
+				}
+				return cli
+			}, nil
+		},
+	})
+}
+
 type ClientProvider func() benchclient.Client
 
-func BuildClientProviders(options *Options) map[string]ClientProvider {
-	m := make(map[string]ClientProvider)
-	if options.S3 != "" {
-		m[ProviderS3] = GenS3ClientProvider(options.S3)
-	}
-	if options.Redis != "" {
-		m[ProviderRedis] = GenRedisClientProvider(options.Redis, options.RedisCluster)
+// SelectMainProvider returns the name of the main service: the one specified, or the first enabled one not used as
+// the failover or the mirror, or the default.
+func SelectMainProvider(options *Options) string {
+	if options.Provider != "" {
+		return strings.ToLower(options.Provider)
 	}
-	if options.Dummy {
-		m[ProviderDummy] = GenDummyClientProvider(options.Bandwidth, benchclient.DummyStore)
+
+	var candidates []string
+	for _, name := range benchclient.EnabledProviders() {
+		if name == strings.ToLower(options.Mirror) {
+			continue
+		} else if name == strings.ToLower(options.Failover) {
+			if p, _ := benchclient.LookupProvider(name); !p.Dual {
+				continue
+			}
+		}
+		candidates = append(candidates, name)
 	}
-	if len(m) == 0 {
-		m[ProviderDefault] = GenDefaultClientProvider(options)
+	if len(candidates) == 0 {
+		return ProviderDefault
+	} else if len(candidates) > 1 {
+		log.Warn("Services %v enabled, %s is selected as the main service. Use -provider to select one.", candidates, candidates[0])
 	}
-	return m
+	return candidates[0]
 }
 
-func GenS3ClientProvider(bucket string) ClientProvider {
-	return func() benchclient.Client {
-		return benchclient.NewS3(bucket)
+// NewClientProvider resolves the name through the registry, and returns the provider of clients playing the role.
+func NewClientProvider(name string, role string, options *Options) (ClientProvider, error) {
+	factory, err := benchclient.NewProviderFactory(name, &benchclient.ProviderEnv{
+		Role:          role,
+		Failover:      options.Failover,
+		AddrList:      options.AddrList,
+		Concurrency:   options.Concurrency,
+		Bandwidth:     options.Bandwidth,
+		DataShards:    options.Datashard,
+		ParityShards:  options.Parityshard,
+		MaxGoroutines: options.ECmaxgoroutine,
+		Dryrun:        options.Dryrun,
+		Lean:          options.Lean,
+	})
+	if err != nil {
+		return nil, err
+	}
+	provider := ClientProvider(factory)
+	if strings.ToLower(name) != ProviderDefault {
+		provider = ErasureClientProvider(provider, options)
 	}
+	return provider, nil
 }
 
-func GenRedisClientProvider(addr string, cluster int) ClientProvider {
-	if cluster > 1 {
-		return func() benchclient.Client {
-			return benchclient.NewElasticCache(addr, cluster, 0)
+// ErasureClientProvider encodes objects into -d/-p shards over -ecBackends clients of the provider if -ec is set.
+func ErasureClientProvider(provider ClientProvider, options *Options) ClientProvider {
+	if !options.ErasureCode {
+		return provider
+	}
+	opts := ErasureOptions(options)
+	return func() benchclient.Client {
+		backends := make([]benchclient.Client, options.ErasureBackends)
+		for i := range backends {
+			backends[i] = provider()
 		}
-	} else {
-		return func() benchclient.Client {
-			return benchclient.NewRedis(addr)
+		cli, err := benchclient.NewErasure(backends, opts)
+		if err != nil {
+			// Unexpected, options are validated on start.
+			log.Error("Failed to create the erasure client: %v", err)
+			os.Exit(1)
 		}
+		return cli
 	}
 }
 
-func GenDummyClientProvider(bandwidth int64, t string) ClientProvider {
-	return func() benchclient.Client {
-		return benchclient.NewDummy(bandwidth, t)
+// ErasureOptions returns options of erasure coding by -d/-p/-g. Shards are not decoded in lean mode.
+func ErasureOptions(options *Options) benchclient.ErasureOptions {
+	return benchclient.ErasureOptions{
+		DataShards:    options.Datashard,
+		ParityShards:  options.Parityshard,
+		MaxGoroutines: options.ECmaxgoroutine,
+		DiscardReads:  options.Lean,
 	}
 }
 
-func GenDefaultClientProvider(options *Options) ClientProvider {
-	addrArr := strings.Split(options.AddrList, ",")
+// ChainClientProvider decorates clients of the provider with middlewares, the first middleware is the innermost one.
+func ChainClientProvider(provider ClientProvider, middlewares ...benchclient.Middleware) ClientProvider {
+	if len(middlewares) == 0 {
+		return provider
+	}
 	return func() benchclient.Client {
-		cli := client.NewClient(options.Datashard, options.Parityshard, options.ECmaxgoroutine)
-		if !options.Dryrun {
-			cli.Dial(addrArr)
+		return benchclient.Chain(provider(), middlewares...)
+	}
+}
+
+// ParseHedgeOptions parses the hedging delay: a duration like 100ms, or a percentile of latencies observed like p95.
+func ParseHedgeOptions(spec string) (benchclient.HedgeOptions, error) {
+	opts := benchclient.HedgeOptions{}
+	if strings.HasPrefix(strings.ToLower(spec), "p") {
+		percentile, err := strconv.ParseFloat(spec[1:], 64)
+		if err != nil || percentile <= 0 || percentile >= 100 {
+			return opts, fmt.Errorf("invalid percentile: %s", spec)
 		}
-		return cli
+		opts.Percentile = percentile
+		return opts, nil
+	}
+
+	delay, err := time.ParseDuration(spec)
+	if err != nil || delay <= 0 {
+		return opts, fmt.Errorf("invalid delay: %s", spec)
 	}
+	opts.Delay = delay
+	return opts, nil
 }
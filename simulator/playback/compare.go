@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/csv"
+	sysflag "flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sionreview/sionreplayer/benchclient"
+)
+
+const (
+	CompareCommand = "compare"
+
+	// CompareAlpha The default significance level of latency differences.
+	CompareAlpha = 0.05
+
+	// compareInsignificant Marks latency differences not significant.
+	compareInsignificant = " n.s."
+)
+
+var (
+	// compareIgnoredFlags Flags that do not affect results.
+	compareIgnoredFlags = map[string]bool{
+		"h":             true,
+		"addrlist":      true,
+		"CSV":           true,
+		"disable-debug": true,
+		"summary-only":  true,
+		"file":          true,
+		"results":       true,
+		"latencies":     true,
+		"interval":      true,
+		"intervalClock": true,
+		"intervalFile":  true,
+		"metrics":       true,
+		"spans":         true,
+		"spanRate":      true,
+		"spanSlow":      true,
+		"logSample":     true,
+		"logFile":       true,
+	}
+)
+
+// CompareOptions Options of the compare subcommand.
+type CompareOptions struct {
+	Alpha     float64
+	CSV       bool
+	Latencies string
+}
+
+// compareRun A run compared, labeled by options different from other runs.
+type compareRun struct {
+	Name      string
+	Label     string
+	Report    *Report
+	Latencies map[string]*benchclient.Histogram // Latencies of all providers and results by operation.
+}
+
+func compareHelpInfo(flag *sysflag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Usage: ./playback compare [options] base_report.json file_report.json [file_report.json ...]\n")
+	fmt.Fprintf(os.Stderr, "Compares runs against the first one by options different. Latency differences not significant are marked as%s: means by Welch's t-test, and percentiles by overlaps of confidence intervals of percentiles.\n", compareInsignificant)
+	fmt.Fprintf(os.Stderr, "Available options:\n")
+	flag.PrintDefaults()
+}
+
+// compareMain runs the compare subcommand and returns the exit code.
+func compareMain(args []string) int {
+	flag := sysflag.NewFlagSet(CompareCommand, sysflag.ContinueOnError)
+
+	var printInfo bool
+	flag.BoolVar(&printInfo, "h", false, "help info?")
+
+	options := &CompareOptions{}
+	flag.Float64Var(&options.Alpha, "alpha", CompareAlpha, "significance level of latency differences.")
+	flag.BoolVar(&options.CSV, "csv", false, "print the table as CSV.")
+	flag.StringVar(&options.Latencies, "latencies", "", "latency files saved by -latencies of runs separated by ',', in the order of reports, replacing latencies in reports. Files of repeated runs joined by '+' are merged, e.g. a1.json+a2.json,b.json. Empty entries use reports.")
+
+	if err := flag.Parse(args); err != nil {
+		printInfo = true
+	}
+	if printInfo || flag.NArg() < 2 {
+		compareHelpInfo(flag)
+		return 0
+	}
+
+	var latencyFiles []string
+	if options.Latencies != "" {
+		latencyFiles = strings.Split(options.Latencies, ",")
+	}
+	runs := make([]*compareRun, flag.NArg())
+	for i, path := range flag.Args() {
+		report, err := LoadReport(path)
+		if err != nil {
+			log.Error("Failed to load reports: %v", err)
+			return 1
+		}
+		latencies := report.LatencyHistograms()
+		if i < len(latencyFiles) && strings.TrimSpace(latencyFiles[i]) != "" {
+			if latencies, err = LoadLatencyHistograms(strings.Split(strings.TrimSpace(latencyFiles[i]), "+")...); err != nil {
+				log.Error("Failed to load latencies: %v", err)
+				return 1
+			}
+		}
+		runs[i] = newCompareRun(RunName(path), report, latencies)
+		if report.TraceFile != runs[0].Report.TraceFile {
+			log.Warn("%s replayed %s, which is different from %s of %s", runs[i].Name, report.TraceFile, runs[0].Report.TraceFile, runs[0].Name)
+		}
+	}
+	labelCompareRuns(runs)
+
+	rows := compareRows(runs, options.Alpha)
+	var err error
+	if options.CSV {
+		err = writeCompareCSV(os.Stdout, rows)
+	} else {
+		err = writeCompareTable(os.Stdout, rows)
+	}
+	if err != nil {
+		log.Error("Failed to print the comparison: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func newCompareRun(name string, report *Report, latencies *LatencyHistograms) *compareRun {
+	run := &compareRun{Name: name, Report: report, Latencies: make(map[string]*benchclient.Histogram, len(LatencyOps))}
+	for _, op := range LatencyOps {
+		run.Latencies[op] = latencies.Filter(func(key LatencyKey) bool { return key.Op == op })
+	}
+	return run
+}
+
+// labelCompareRuns labels runs by options with different values among runs, e.g. "-balance=true -cluster=400".
+func labelCompareRuns(runs []*compareRun) {
+	values := make([]map[string]string, len(runs))
+	keys := make(map[string]bool)
+	for i, run := range runs {
+		values[i] = compareOptionValues(run.Report)
+		for key := range values[i] {
+			keys[key] = true
+		}
+	}
+
+	var diffs []string
+	for key := range keys {
+		for i := 1; i < len(runs); i++ {
+			if values[i][key] != values[0][key] {
+				diffs = append(diffs, key)
+				break
+			}
+		}
+	}
+	sort.Strings(diffs)
+
+	for i, run := range runs {
+		labels := make([]string, len(diffs))
+		for j, key := range diffs {
+			labels[j] = "-" + key + "=" + values[i][key]
+		}
+		run.Label = strings.Join(labels, " ")
+	}
+}
+
+// compareOptionValues returns values of flags affecting results.
+func compareOptionValues(report *Report) map[string]string {
+	values := make(map[string]string)
+	for name, value := range report.Flags {
+		if !compareIgnoredFlags[name] {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+func compareRows(runs []*compareRun, alpha float64) [][]string {
+	base := runs[0]
+	header := []string{"metric"}
+	labels := []string{"options"}
+	for i, run := range runs {
+		header = append(header, run.Name)
+		if i == 0 {
+			labels = append(labels, "(base)")
+		} else {
+			labels = append(labels, run.Label)
+		}
+	}
+	rows := [][]string{header, labels}
+
+	row := func(name string, value func(*compareRun) float64, format func(float64) string, delta func(float64, float64) string) {
+		cells := []string{name, format(value(base))}
+		for _, run := range runs[1:] {
+			cells = append(cells, format(value(run))+" ("+delta(value(base), value(run))+")")
+		}
+		rows = append(rows, cells)
+	}
+	percentage := func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) }
+	bytes := func(v float64) string { return humanize.Bytes(uint64(v)) }
+	count := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	duration := func(v float64) string { return time.Duration(v).String() }
+
+	row("hit ratio", func(r *compareRun) float64 { return r.Report.Gets.HitRatio }, percentage, compareDeltaPoints)
+	row("near cache hit ratio", func(r *compareRun) float64 { return r.Report.Gets.NearCacheHitRatio }, percentage, compareDeltaPoints)
+	row("chunk hit ratio", func(r *compareRun) float64 { return r.Report.Chunks.HitRatio }, percentage, compareDeltaPoints)
+	row("memory", func(r *compareRun) float64 { return float64(r.Report.Memory.Total) }, bytes, compareDeltaRelative)
+	row("memory per lambda max", func(r *compareRun) float64 { return float64(r.Report.Memory.Max) }, bytes, compareDeltaRelative)
+	row("active minutes", func(r *compareRun) float64 { return float64(r.Report.ActiveMinutes) }, count, compareDeltaRelative)
+	row("balancer cost", func(r *compareRun) float64 { return float64(r.Report.BalancerCost) }, duration, compareDeltaRelative)
+	row("balancer cost per request", func(r *compareRun) float64 { return float64(r.Report.BalancerCostPerRequest()) }, duration, compareDeltaRelative)
+
+	for _, op := range LatencyOps {
+		if base.Latencies[op].Count() == 0 {
+			continue
+		}
+
+		// Means are flagged by Welch's t-test, and percentiles by confidence intervals of the percentiles.
+		pValues := make([]string, len(runs))
+		pValues[0] = "-"
+		for i, run := range runs[1:] {
+			pValues[i+1] = fmt.Sprintf("%.3g", WelchTTest(base.Latencies[op], run.Latencies[op]))
+		}
+		latencyRow := func(name string, value func(*benchclient.Histogram) float64, significant func(a, b *benchclient.Histogram) bool) {
+			cells := []string{op + " " + name, duration(value(base.Latencies[op]))}
+			for _, run := range runs[1:] {
+				if run.Latencies[op].Count() == 0 {
+					cells = append(cells, "-")
+					continue
+				}
+				cell := duration(value(run.Latencies[op])) + " (" + compareDeltaRelative(value(base.Latencies[op]), value(run.Latencies[op])) + ")"
+				if !significant(base.Latencies[op], run.Latencies[op]) {
+					cell += compareInsignificant
+				}
+				cells = append(cells, cell)
+			}
+			rows = append(rows, cells)
+		}
+
+		latencyRow("mean", func(h *benchclient.Histogram) float64 { return math.Round(h.Mean()) },
+			func(a, b *benchclient.Histogram) bool { return WelchTTest(a, b) < alpha })
+		for _, p := range LatencyPercentiles {
+			p := p
+			latencyRow(PercentileName(p), func(h *benchclient.Histogram) float64 { return float64(h.Percentile(p)) },
+				func(a, b *benchclient.Histogram) bool { return PercentilesDiffer(a, b, p, alpha) })
+		}
+		rows = append(rows, append([]string{op + " mean p-value"}, pValues...))
+	}
+	return rows
+}
+
+// compareDeltaPoints returns the difference of ratios in percentage points.
+func compareDeltaPoints(base float64, v float64) string {
+	return fmt.Sprintf("%+.2fpp", (v-base)*100)
+}
+
+// compareDeltaRelative returns the difference relative to the base.
+func compareDeltaRelative(base float64, v float64) string {
+	if base == 0 {
+		if v == 0 {
+			return "+0.0%"
+		}
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (v-base)/base*100)
+}
+
+func writeCompareTable(w io.Writer, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCompareCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+// PercentilesDiffer returns true if the confidence intervals at the level 1-alpha of the percentile p in [0, 100] of two
+// histograms do not overlap. The test is conservative: the chance of differences reported by random is below alpha.
+func PercentilesDiffer(a *benchclient.Histogram, b *benchclient.Histogram, p float64, alpha float64) bool {
+	aLow, aHigh := PercentileInterval(a, p, alpha)
+	bLow, bHigh := PercentileInterval(b, p, alpha)
+	return aHigh < bLow || bHigh < aLow
+}
+
+// PercentileInterval returns the distribution-free confidence interval at the level 1-alpha of the percentile p in
+// [0, 100]. The interval is bounded by values of ranks decided by the binomial distribution of the number of samples
+// below the percentile, approximated by the normal distribution.
+func PercentileInterval(h *benchclient.Histogram, p float64, alpha float64) (int64, int64) {
+	n := float64(h.Count())
+	if n == 0 {
+		return 0, 0
+	}
+	q := p / 100
+	z := math.Sqrt2 * math.Erfinv(1-alpha)
+	half := z * math.Sqrt(n*q*(1-q))
+	low := math.Max(math.Floor(n*q-half), 1)
+	high := math.Min(math.Ceil(n*q+half)+1, n)
+	return h.Percentile(low / n * 100), h.Percentile(high / n * 100)
+}
+
+// WelchTTest returns the two-tailed p-value of Welch's t-test on means of latencies of two histograms. Samples of
+// which the variance can not be estimated are considered different if means are different.
+func WelchTTest(a *benchclient.Histogram, b *benchclient.Histogram) float64 {
+	na, nb := float64(a.Count()), float64(b.Count())
+	if na < 2 || nb < 2 {
+		if a.Mean() == b.Mean() {
+			return 1
+		}
+		return 0
+	}
+
+	va, vb := a.StdDev()*a.StdDev()/na, b.StdDev()*b.StdDev()/nb
+	if va+vb == 0 {
+		if a.Mean() == b.Mean() {
+			return 1
+		}
+		return 0
+	}
+	t := (a.Mean() - b.Mean()) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+	return studentTTwoTailed(t, df)
+}
+
+// studentTTwoTailed returns P(|T| >= |t|) of Student's t-distribution with df degrees of freedom.
+func studentTTwoTailed(t float64, df float64) float64 {
+	return regularizedIncompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), evaluated by the continued fraction.
+func regularizedIncompleteBeta(a float64, b float64, x float64) float64 {
+	if x <= 0 {
+		return 0
+	} else if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges fast for x < (a+1)/(a+b+2), use the symmetry otherwise.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a float64, b float64, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		// Even step.
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		// Odd step.
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	sysflag "flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/sionreview/sionreplayer/benchclient"
+)
+
+const (
+	DecodeCommand = "decode"
+
+	DecodeFormatCSV      = "csv"      // One CSV file per handle.
+	DecodeFormatJSONL    = "jsonl"    // One JSON object per line, named by the "handle" field.
+	DecodeFormatColumnar = "columnar" // One typed CSV file per column of each handle, aligned by row.
+
+	DecodeJoinedTable = "joined"
+)
+
+// DecodeOptions Options of the decode subcommand.
+type DecodeOptions struct {
+	Format string
+	Output string
+	Join   bool
+}
+
+// decodeTable Records of a handle, identified by the format. Tables of the same format in multiple files are merged.
+type decodeTable struct {
+	Name   string
+	Schema *benchclient.LogSchema
+}
+
+// joinedRequest Records of all handles sharing a reqId.
+type joinedRequest struct {
+	ReqId   string
+	Records map[*decodeTable][][]interface{}
+}
+
+// decodeSink Writes records decoded in a format.
+type decodeSink interface {
+	Write(table *decodeTable, values []interface{}) error
+	WriteJoined(joined *joinedRequest, tables []*decodeTable) error
+	Close() error
+}
+
+func decodeHelpInfo(flag *sysflag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Usage: ./playback decode [options] file.clog [file.clog ...]\n")
+	fmt.Fprintf(os.Stderr, "Decodes nanolog files written by the playback, the SION client and the proxy. Records of files given are joined by reqId if -join is set.\n")
+	fmt.Fprintf(os.Stderr, "Available options:\n")
+	flag.PrintDefaults()
+}
+
+// decodeMain runs the decode subcommand and returns the exit code.
+func decodeMain(args []string) int {
+	flag := sysflag.NewFlagSet(DecodeCommand, sysflag.ContinueOnError)
+
+	var printInfo bool
+	flag.BoolVar(&printInfo, "h", false, "help info?")
+
+	options := &DecodeOptions{}
+	flag.StringVar(&options.Format, "format", DecodeFormatCSV, "output format: csv, jsonl or columnar.")
+	flag.StringVar(&options.Output, "o", "", "output prefix, defaults to the first file without the .clog extension. Use - to write jsonl to stdout.")
+	flag.BoolVar(&options.Join, "join", false, "join records of all handles by reqId, records without reqId are written as is.")
+
+	if err := flag.Parse(args); err != nil {
+		printInfo = true
+	}
+	if printInfo || flag.NArg() < 1 {
+		decodeHelpInfo(flag)
+		return 0
+	}
+	if options.Output == "" {
+		options.Output = strings.TrimSuffix(flag.Arg(0), ".clog")
+	}
+
+	var sink decodeSink
+	switch strings.ToLower(options.Format) {
+	case DecodeFormatCSV:
+		sink = &csvSink{prefix: options.Output, writers: make(map[*decodeTable]*csvFile)}
+	case DecodeFormatJSONL:
+		out := os.Stdout
+		if options.Output != "-" {
+			file, err := os.Create(options.Output + ".jsonl")
+			if err != nil {
+				log.Error("Failed to create output: %v", err)
+				return 1
+			}
+			out = file
+		}
+		sink = &jsonlSink{file: out, w: bufio.NewWriter(out)}
+	case DecodeFormatColumnar:
+		dir := options.Output + "_columns"
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Error("Failed to create output: %v", err)
+			return 1
+		}
+		sink = &columnarSink{dir: dir, writers: make(map[*decodeTable][]*columnFile)}
+	default:
+		log.Error("Unsupported format: %s, valid choices: %s, %s, %s", options.Format, DecodeFormatCSV, DecodeFormatJSONL, DecodeFormatColumnar)
+		return 1
+	}
+
+	err := decodeFiles(flag.Args(), options, sink)
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error("Failed to decode: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// decodeFiles decodes files to the sink.
+func decodeFiles(paths []string, options *DecodeOptions, sink decodeSink) error {
+	tables := make(map[string]*decodeTable) // Keyed by format.
+	names := make(map[string]bool)
+	var joinable []*decodeTable
+	var joined []*joinedRequest
+	joinedByReqId := make(map[string]*joinedRequest)
+
+	tableOf := func(schema *benchclient.LogSchema) *decodeTable {
+		if table, ok := tables[schema.Format]; ok {
+			return table
+		}
+		table := &decodeTable{Name: schema.Name, Schema: schema}
+		for i := 1; names[table.Name]; i++ {
+			// Handles unknown in different files may share the name.
+			table.Name = fmt.Sprintf("%s_%d", schema.Name, i)
+		}
+		names[table.Name] = true
+		tables[schema.Format] = table
+		if schema.ReqIdColumn() >= 0 {
+			joinable = append(joinable, table)
+		}
+		return table
+	}
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		decoder := benchclient.NewLogDecoder(file)
+		records := 0
+		for {
+			record, err := decoder.Next()
+			if err == io.EOF {
+				break
+			} else if err == io.ErrUnexpectedEOF {
+				log.Warn("%s is truncated, %d records decoded", path, records)
+				break
+			} else if err != nil {
+				file.Close()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			records++
+
+			table := tableOf(record.Schema)
+			reqId := record.ReqId()
+			if !options.Join || reqId == "" {
+				if err := sink.Write(table, record.Values); err != nil {
+					file.Close()
+					return err
+				}
+				continue
+			}
+
+			request, ok := joinedByReqId[reqId]
+			if !ok {
+				request = &joinedRequest{ReqId: reqId, Records: make(map[*decodeTable][][]interface{})}
+				joinedByReqId[reqId] = request
+				joined = append(joined, request)
+			}
+			request.Records[table] = append(request.Records[table], record.Values)
+		}
+		file.Close()
+		log.Info("Decoded %d records of %d handles from %s", records, len(decoder.Schemas()), path)
+	}
+
+	for _, request := range joined {
+		if err := sink.WriteJoined(request, joinable); err != nil {
+			return err
+		}
+	}
+	if options.Join {
+		log.Info("Joined %d requests", len(joined))
+	}
+	return nil
+}
+
+// joinedSchema returns the flattened schema of joined requests: the reqId, then for each handle the number of records
+// and fields of the first record.
+func joinedSchema(tables []*decodeTable) *benchclient.LogSchema {
+	schema := &benchclient.LogSchema{Name: DecodeJoinedTable, Columns: []string{"reqId"}, Kinds: []reflect.Kind{reflect.String}}
+	for _, table := range tables {
+		schema.Columns = append(schema.Columns, table.Name+".records")
+		schema.Kinds = append(schema.Kinds, reflect.Int64)
+		reqIdCol := table.Schema.ReqIdColumn()
+		for i, col := range table.Schema.Columns {
+			if i != reqIdCol {
+				schema.Columns = append(schema.Columns, table.Name+"."+col)
+				schema.Kinds = append(schema.Kinds, table.Schema.Kinds[i])
+			}
+		}
+	}
+	return schema
+}
+
+// flattenJoined returns values of the joined request following joinedSchema. Fields of handles without records are nil.
+func flattenJoined(joined *joinedRequest, tables []*decodeTable) []interface{} {
+	values := []interface{}{joined.ReqId}
+	for _, table := range tables {
+		records := joined.Records[table]
+		values = append(values, int64(len(records)))
+		reqIdCol := table.Schema.ReqIdColumn()
+		for i := range table.Schema.Columns {
+			if i == reqIdCol {
+				continue
+			} else if len(records) > 0 {
+				values = append(values, records[0][i])
+			} else {
+				values = append(values, nil)
+			}
+		}
+	}
+	return values
+}
+
+func formatDecodedValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// csvFile A buffered CSV file.
+type csvFile struct {
+	file *os.File
+	w    *csv.Writer
+}
+
+func createCSVFile(path string, header []string) (*csvFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(bufio.NewWriter(file))
+	if err := w.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &csvFile{file: file, w: w}, nil
+}
+
+func (f *csvFile) Close() error {
+	f.w.Flush()
+	err := f.w.Error()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// csvSink Writes <prefix>_<handle>.csv files.
+type csvSink struct {
+	prefix  string
+	writers map[*decodeTable]*csvFile
+	joined  *decodeTable
+	row     []string
+}
+
+func (s *csvSink) Write(table *decodeTable, values []interface{}) error {
+	w, ok := s.writers[table]
+	if !ok {
+		var err error
+		w, err = createCSVFile(fmt.Sprintf("%s_%s.csv", s.prefix, table.Name), table.Schema.Columns)
+		if err != nil {
+			return err
+		}
+		s.writers[table] = w
+	}
+
+	s.row = s.row[:0]
+	for _, value := range values {
+		s.row = append(s.row, formatDecodedValue(value))
+	}
+	return w.w.Write(s.row)
+}
+
+func (s *csvSink) WriteJoined(joined *joinedRequest, tables []*decodeTable) error {
+	if s.joined == nil {
+		s.joined = &decodeTable{Name: DecodeJoinedTable, Schema: joinedSchema(tables)}
+	}
+	return s.Write(s.joined, flattenJoined(joined, tables))
+}
+
+func (s *csvSink) Close() (err error) {
+	for _, w := range s.writers {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// columnFile A buffered file of a column. A value per line, empty strings are quoted so that lines are not skipped as
+// blank lines by CSV readers.
+type columnFile struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func createColumnFile(path string, header string) (*columnFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &columnFile{file: file, w: bufio.NewWriter(file)}
+	if err := f.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *columnFile) Write(value string) error {
+	if value == "" || strings.ContainsAny(value, "\",\r\n") || value[0] == ' ' {
+		value = `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+	}
+	f.w.WriteString(value)
+	return f.w.WriteByte('\n')
+}
+
+func (f *columnFile) Close() error {
+	err := f.w.Flush()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// columnarSink Writes <dir>/<handle>.<column>.csv files. The header of a file is "<column>:<type>", followed by one
+// value per row. Files of a handle have the same number of rows.
+type columnarSink struct {
+	dir     string
+	writers map[*decodeTable][]*columnFile
+	joined  *decodeTable
+}
+
+func (s *columnarSink) Write(table *decodeTable, values []interface{}) error {
+	ws, ok := s.writers[table]
+	if !ok {
+		ws = make([]*columnFile, len(table.Schema.Columns))
+		for i, col := range table.Schema.Columns {
+			w, err := createColumnFile(filepath.Join(s.dir, fmt.Sprintf("%s.%s.csv", table.Name, col)), col+":"+table.Schema.Type(i))
+			if err != nil {
+				return err
+			}
+			ws[i] = w
+		}
+		s.writers[table] = ws
+	}
+
+	for i, value := range values {
+		if err := ws[i].Write(formatDecodedValue(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *columnarSink) WriteJoined(joined *joinedRequest, tables []*decodeTable) error {
+	if s.joined == nil {
+		s.joined = &decodeTable{Name: DecodeJoinedTable, Schema: joinedSchema(tables)}
+	}
+	return s.Write(s.joined, flattenJoined(joined, tables))
+}
+
+func (s *columnarSink) Close() (err error) {
+	for _, ws := range s.writers {
+		for _, w := range ws {
+			if closeErr := w.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return
+}
+
+// jsonlSink Writes a JSON object per line. Joined requests list records of each handle in arrays.
+type jsonlSink struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func (s *jsonlSink) Write(table *decodeTable, values []interface{}) error {
+	s.w.WriteString(`{"handle":`)
+	s.writeValue(table.Name)
+	for i, col := range table.Schema.Columns {
+		s.w.WriteByte(',')
+		s.writeValue(col)
+		s.w.WriteByte(':')
+		if err := s.writeValue(values[i]); err != nil {
+			return err
+		}
+	}
+	_, err := s.w.WriteString("}\n")
+	return err
+}
+
+func (s *jsonlSink) WriteJoined(joined *joinedRequest, tables []*decodeTable) error {
+	s.w.WriteString(`{"handle":"` + DecodeJoinedTable + `","reqId":`)
+	s.writeValue(joined.ReqId)
+	for _, table := range tables {
+		records, ok := joined.Records[table]
+		if !ok {
+			continue
+		}
+		s.w.WriteByte(',')
+		s.writeValue(table.Name)
+		s.w.WriteString(":[")
+		for i, values := range records {
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			s.w.WriteByte('{')
+			for j, col := range table.Schema.Columns {
+				if j > 0 {
+					s.w.WriteByte(',')
+				}
+				s.writeValue(col)
+				s.w.WriteByte(':')
+				if err := s.writeValue(values[j]); err != nil {
+					return err
+				}
+			}
+			s.w.WriteByte('}')
+		}
+		s.w.WriteByte(']')
+	}
+	_, err := s.w.WriteString("}\n")
+	return err
+}
+
+func (s *jsonlSink) writeValue(value interface{}) error {
+	if c, ok := value.(complex128); ok {
+		value = fmt.Sprint(c)
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(buf)
+	return err
+}
+
+func (s *jsonlSink) Close() error {
+	err := s.w.Flush()
+	if s.file != os.Stdout {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"encoding/csv"
+	sysflag "flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	ReportCommand = "report"
+
+	// reportSuffix and intervalsSuffix Suffixes of files written by runs with -file.
+	reportSuffix    = "_report.json"
+	intervalsSuffix = "_intervals.csv"
+
+	chartWidth        = 640
+	chartHeight       = 360
+	chartMarginLeft   = 80
+	chartMarginRight  = 20
+	chartMarginTop    = 56
+	chartMarginBottom = 48
+	chartTicks        = 5
+)
+
+var (
+	chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+	// cdfPercentiles Percentiles sampled to draw CDFs of latencies.
+	cdfPercentiles = []float64{1, 5, 10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99, 99.5, 99.9, 99.99}
+)
+
+// HTMLReportOptions Options of the report subcommand.
+type HTMLReportOptions struct {
+	Output    string
+	Title     string
+	Intervals string
+}
+
+// reportRun A run rendered, with the series of intervals if available.
+type reportRun struct {
+	Name      string
+	Color     string
+	Report    *Report
+	Intervals map[string][]float64 // Columns of the interval CSV by name.
+	Summary   string
+}
+
+type reportRow struct {
+	Name   string
+	Values []string
+}
+
+type htmlReportPage struct {
+	Title     string
+	Generated string
+	Runs      []*reportRun
+	Rows      []*reportRow
+	Charts    []template.HTML
+}
+
+var htmlReportTemplate = template.Must(template.New(ReportCommand).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child { text-align: left; }
+.swatch { display: inline-block; width: 10px; height: 10px; margin-right: 6px; }
+.charts { display: flex; flex-wrap: wrap; gap: 16px; }
+.charts svg { border: 1px solid #eee; }
+pre { background: #f7f7f7; padding: 8px; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated at {{.Generated}}.</p>
+<table>
+<tr><th>Run</th>{{range .Runs}}<th><span class="swatch" style="background: {{.Color}}"></span>{{.Name}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Name}}</th>{{range .Values}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+<div class="charts">
+{{range .Charts}}{{.}}
+{{end}}</div>
+{{range .Runs}}<details>
+<summary>Summary of {{.Name}}</summary>
+<pre>{{.Summary}}</pre>
+</details>
+{{end}}</body>
+</html>
+`))
+
+func htmlReportHelpInfo(flag *sysflag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "Usage: ./playback report [options] file_report.json [file_report.json ...]\n")
+	fmt.Fprintf(os.Stderr, "Renders run reports to a self-contained HTML file, runs given are compared side by side. Intervals are read from file_intervals.csv next to the report if exists.\n")
+	fmt.Fprintf(os.Stderr, "Available options:\n")
+	flag.PrintDefaults()
+}
+
+// htmlReportMain runs the report subcommand and returns the exit code.
+func htmlReportMain(args []string) int {
+	flag := sysflag.NewFlagSet(ReportCommand, sysflag.ContinueOnError)
+
+	var printInfo bool
+	flag.BoolVar(&printInfo, "h", false, "help info?")
+
+	options := &HTMLReportOptions{}
+	flag.StringVar(&options.Output, "o", "", "output HTML file, defaults to the first report with the .html extension.")
+	flag.StringVar(&options.Title, "title", "", "title of the page, defaults to the names of runs.")
+	flag.StringVar(&options.Intervals, "intervals", "", "interval CSV files of runs separated by ',', in the order of reports. Empty to find file_intervals.csv next to the report.")
+
+	if err := flag.Parse(args); err != nil {
+		printInfo = true
+	}
+	if printInfo || flag.NArg() < 1 {
+		htmlReportHelpInfo(flag)
+		return 0
+	}
+	if options.Output == "" {
+		options.Output = strings.TrimSuffix(strings.TrimSuffix(flag.Arg(0), reportSuffix), ".json") + ".html"
+	}
+
+	var intervals []string
+	if options.Intervals != "" {
+		intervals = strings.Split(options.Intervals, ",")
+	}
+	runs, err := loadReportRuns(flag.Args(), intervals)
+	if err != nil {
+		log.Error("Failed to load reports: %v", err)
+		return 1
+	}
+
+	file, err := os.Create(options.Output)
+	if err != nil {
+		log.Error("Failed to create output: %v", err)
+		return 1
+	}
+	err = renderHTMLReport(file, options.Title, runs)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error("Failed to render the report: %v", err)
+		return 1
+	}
+	log.Info("Rendered %d runs to %s", len(runs), options.Output)
+	return 0
+}
+
+// loadReportRuns loads reports and intervals of runs. Intervals are optional: empty paths are derived from reports,
+// and missing files derived are ignored.
+func loadReportRuns(paths []string, intervals []string) ([]*reportRun, error) {
+	runs := make([]*reportRun, len(paths))
+	for i, path := range paths {
+		report, err := LoadReport(path)
+		if err != nil {
+			return nil, err
+		}
+		run := &reportRun{
+			Name:    RunName(path),
+			Color:   chartColors[i%len(chartColors)],
+			Report:  report,
+			Summary: strings.Join(report.Summary(), "\n"),
+		}
+
+		intervalsPath := ""
+		if i < len(intervals) {
+			intervalsPath = strings.TrimSpace(intervals[i])
+		}
+		if intervalsPath == "" && strings.HasSuffix(path, reportSuffix) {
+			derived := strings.TrimSuffix(path, reportSuffix) + intervalsSuffix
+			if _, err := os.Stat(derived); err == nil {
+				intervalsPath = derived
+			}
+		}
+		if intervalsPath != "" {
+			if run.Intervals, err = loadIntervalColumns(intervalsPath); err != nil {
+				return nil, err
+			}
+		}
+		runs[i] = run
+	}
+	return runs, nil
+}
+
+// RunName returns the name of the run of the report file, e.g. "run" of "path/run_report.json".
+func RunName(path string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), reportSuffix), ".json")
+}
+
+// loadIntervalColumns reads the interval CSV written by -intervalFile as columns of numbers by name.
+func loadIntervalColumns(path string) (map[string][]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	columns := make(map[string][]float64, len(header))
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i, field := range row {
+			if i >= len(header) {
+				break
+			}
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: column %s: %w", path, header[i], err)
+			}
+			columns[header[i]] = append(columns[header[i]], v)
+		}
+	}
+	return columns, nil
+}
+
+func renderHTMLReport(w io.Writer, title string, runs []*reportRun) error {
+	page := &htmlReportPage{
+		Title:     title,
+		Generated: time.Now().Format(TIME_PATTERN2),
+		Runs:      runs,
+		Rows:      reportRows(runs),
+	}
+	if page.Title == "" {
+		names := make([]string, len(runs))
+		for i, run := range runs {
+			names[i] = run.Name
+		}
+		page.Title = "Replay report: " + strings.Join(names, " vs ")
+	}
+
+	if chart := hitRatioChart(runs); chart != nil {
+		page.Charts = append(page.Charts, chart.SVG())
+	}
+	for _, chart := range latencyCDFCharts(runs) {
+		page.Charts = append(page.Charts, chart.SVG())
+	}
+	page.Charts = append(page.Charts, lambdaMemoryChart(runs).SVG(), activeMinutesChart(runs).SVG())
+
+	return htmlReportTemplate.Execute(w, page)
+}
+
+// reportRows returns rows of the summary table, a column per run.
+func reportRows(runs []*reportRun) []*reportRow {
+	row := func(name string, value func(*Report) string) *reportRow {
+		r := &reportRow{Name: name, Values: make([]string, len(runs))}
+		for i, run := range runs {
+			r.Values[i] = value(run.Report)
+		}
+		return r
+	}
+	latency := func(op string, p float64) func(*Report) string {
+		return func(r *Report) string {
+			histogram := r.LatencyHistograms().Filter(func(key LatencyKey) bool { return key.Op == op })
+			if histogram.Count() == 0 {
+				return "-"
+			}
+			return histogram.PercentileDuration(p).String()
+		}
+	}
+	return []*reportRow{
+		row("Trace", func(r *Report) string { return filepath.Base(r.TraceFile) }),
+		row("Provider", func(r *Report) string { return r.Provider }),
+		row("Elapsed", func(r *Report) string { return r.Elapsed.Round(time.Millisecond).String() }),
+		row("Records", func(r *Report) string { return strconv.FormatInt(r.Records, 10) }),
+		row("Gets", func(r *Report) string { return strconv.Itoa(int(r.Gets.Total)) }),
+		row("Hit ratio", func(r *Report) string { return fmt.Sprintf("%.2f%%", r.Gets.HitRatio*100) }),
+		row("Near cache hit ratio", func(r *Report) string {
+			if r.NearCache == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%.2f%%", r.Gets.NearCacheHitRatio*100)
+		}),
+		row("Chunk hit ratio", func(r *Report) string { return fmt.Sprintf("%.2f%%", r.Chunks.HitRatio*100) }),
+		row("Memory", func(r *Report) string { return humanize.Bytes(r.Memory.Total) }),
+		row("Memory per lambda", func(r *Report) string {
+			return humanize.Bytes(r.Memory.Min) + " - " + humanize.Bytes(r.Memory.Max)
+		}),
+		row("Active minutes", func(r *Report) string { return strconv.Itoa(r.ActiveMinutes) }),
+		row("Balancer cost", func(r *Report) string { return r.BalancerCost.String() }),
+		row("Max concurrency", func(r *Report) string { return strconv.Itoa(int(r.MaxConcurrency)) }),
+		row("Get p50", latency(LatencyOpGet, 50)),
+		row("Get p99", latency(LatencyOpGet, 99)),
+		row("Set p50", latency(LatencyOpSet, 50)),
+		row("Set p99", latency(LatencyOpSet, 99)),
+	}
+}
+
+// hitRatioChart returns the chart of hit ratios of intervals, nil if no run has intervals.
+func hitRatioChart(runs []*reportRun) *lineChart {
+	chart := &lineChart{
+		Title:   "Hit ratio over time",
+		XLabel:  "time",
+		YLabel:  "hit ratio",
+		XFormat: formatChartDuration,
+		YFormat: formatChartPercent,
+		YMin:    0,
+		YMax:    1,
+	}
+	for _, run := range runs {
+		ends, gets, ratios := run.Intervals["end"], run.Intervals["gets"], run.Intervals["hitRatio"]
+		if len(ends) == 0 || len(ends) != len(gets) || len(ends) != len(ratios) {
+			continue
+		}
+		series := &chartSeries{Name: run.Name, Color: run.Color}
+		for i := range ends {
+			// Intervals without gets have no hit ratio.
+			if gets[i] > 0 {
+				series.Points = append(series.Points, chartPoint{X: ends[i], Y: ratios[i]})
+			}
+		}
+		chart.Series = append(chart.Series, series)
+	}
+	if len(chart.Series) == 0 {
+		return nil
+	}
+	return chart
+}
+
+// latencyCDFCharts returns a chart of CDFs of latencies for each operation recorded.
+func latencyCDFCharts(runs []*reportRun) []*lineChart {
+	latencies := make([]*LatencyHistograms, len(runs))
+	for i, run := range runs {
+		latencies[i] = run.Report.LatencyHistograms()
+	}
+
+	var charts []*lineChart
+	for _, op := range LatencyOps {
+		chart := &lineChart{
+			Title:   "Latency CDF: " + op,
+			XLabel:  "latency",
+			YLabel:  "percentile",
+			XLog:    true,
+			XFormat: formatChartDuration,
+			YFormat: formatChartPercent,
+			YMin:    0,
+			YMax:    1,
+		}
+		for i, run := range runs {
+			histogram := latencies[i].Filter(func(key LatencyKey) bool { return key.Op == op })
+			if histogram.Count() == 0 {
+				continue
+			}
+			series := &chartSeries{Name: run.Name, Color: run.Color}
+			for _, p := range cdfPercentiles {
+				if v := histogram.Percentile(p); v > 0 {
+					series.Points = append(series.Points, chartPoint{X: float64(v), Y: p / 100})
+				}
+			}
+			if max := histogram.Max(); max > 0 {
+				series.Points = append(series.Points, chartPoint{X: float64(max), Y: 1})
+			}
+			chart.Series = append(chart.Series, series)
+		}
+		if len(chart.Series) > 0 {
+			charts = append(charts, chart)
+		}
+	}
+	return charts
+}
+
+// lambdaMemoryChart returns the chart of CDFs of memory consumed by lambdas.
+func lambdaMemoryChart(runs []*reportRun) *lineChart {
+	chart := &lineChart{
+		Title:   "Memory per lambda",
+		XLabel:  "memory",
+		YLabel:  "fraction of lambdas",
+		XFormat: func(v float64) string { return humanize.Bytes(uint64(v)) },
+		YFormat: formatChartPercent,
+		YMin:    0,
+		YMax:    1,
+	}
+	for _, run := range runs {
+		var memory []uint64
+		for _, prxy := range run.Report.Proxies {
+			for _, lambda := range prxy.Lambdas {
+				memory = append(memory, lambda.Memory)
+			}
+		}
+		sort.Slice(memory, func(i, j int) bool { return memory[i] < memory[j] })
+		series := &chartSeries{Name: run.Name, Color: run.Color}
+		for i, m := range memory {
+			series.Points = append(series.Points, chartPoint{X: float64(m), Y: float64(i+1) / float64(len(memory))})
+		}
+		chart.Series = append(chart.Series, series)
+	}
+	return chart
+}
+
+// activeMinutesChart returns the chart of active minutes of runs.
+func activeMinutesChart(runs []*reportRun) *barChart {
+	chart := &barChart{
+		Title:   "Active minutes",
+		YFormat: func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) },
+	}
+	for _, run := range runs {
+		chart.Bars = append(chart.Bars, chartBar{Label: run.Name, Value: float64(run.Report.ActiveMinutes), Color: run.Color})
+	}
+	return chart
+}
+
+func formatChartDuration(v float64) string {
+	d := time.Duration(v)
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	default:
+		return d.String()
+	}
+}
+
+func formatChartPercent(v float64) string {
+	return strconv.FormatFloat(v*100, 'f', -1, 64) + "%"
+}
+
+type chartPoint struct {
+	X float64
+	Y float64
+}
+
+type chartSeries struct {
+	Name   string
+	Color  string
+	Points []chartPoint
+}
+
+// lineChart A chart of series of points, rendered as inline SVG. The range of y is fixed if YMax > YMin.
+type lineChart struct {
+	Title   string
+	XLabel  string
+	YLabel  string
+	XLog    bool
+	XFormat func(float64) string
+	YFormat func(float64) string
+	YMin    float64
+	YMax    float64
+	Series  []*chartSeries
+}
+
+// SVG renders the chart.
+func (c *lineChart) SVG() template.HTML {
+	var svg strings.Builder
+	writeChartHeader(&svg, c.Title, c.XLabel, c.YLabel, c.Series)
+
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMin, yMax := math.Inf(1), math.Inf(-1)
+	for _, series := range c.Series {
+		for _, p := range series.Points {
+			xMin, xMax = math.Min(xMin, c.scaleX(p.X)), math.Max(xMax, c.scaleX(p.X))
+			yMin, yMax = math.Min(yMin, p.Y), math.Max(yMax, p.Y)
+		}
+	}
+	if math.IsInf(xMin, 0) {
+		// No point.
+		svg.WriteString(`<text x="320" y="180" text-anchor="middle">no data</text></svg>`)
+		return template.HTML(svg.String())
+	}
+	if c.YMax > c.YMin {
+		yMin, yMax = c.YMin, c.YMax
+	}
+	xMin, xMax = chartRange(xMin, xMax)
+	yMin, yMax = chartRange(yMin, yMax)
+	if c.XLog {
+		xMin, xMax = math.Floor(xMin), math.Ceil(xMax)
+	}
+
+	left, right := float64(chartMarginLeft), float64(chartWidth-chartMarginRight)
+	top, bottom := float64(chartMarginTop), float64(chartHeight-chartMarginBottom)
+	px := func(x float64) float64 { return left + (x-xMin)/(xMax-xMin)*(right-left) }
+	py := func(y float64) float64 { return bottom - (y-yMin)/(yMax-yMin)*(bottom-top) }
+
+	// Grid and ticks.
+	for _, x := range c.xTicks(xMin, xMax) {
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, px(x), top, px(x), bottom)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="11">%s</text>`, px(x), bottom+16, template.HTMLEscapeString(c.formatX(x)))
+	}
+	for i := 0; i <= chartTicks; i++ {
+		y := yMin + (yMax-yMin)*float64(i)/chartTicks
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, left, py(y), right, py(y))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="end" font-size="11">%s</text>`, left-6, py(y)+4, template.HTMLEscapeString(formatChartValue(c.YFormat, y)))
+	}
+	fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="#999"/>`, left, top, right-left, bottom-top)
+
+	for _, series := range c.Series {
+		points := make([]string, len(series.Points))
+		for i, p := range series.Points {
+			points[i] = fmt.Sprintf("%.1f,%.1f", px(c.scaleX(p.X)), py(p.Y))
+		}
+		if len(points) == 1 {
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(c.scaleX(series.Points[0].X)), py(series.Points[0].Y), series.Color)
+		} else if len(points) > 1 {
+			fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.Join(points, " "), series.Color)
+		}
+	}
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+func (c *lineChart) scaleX(x float64) float64 {
+	if c.XLog {
+		return math.Log10(x)
+	}
+	return x
+}
+
+func (c *lineChart) formatX(x float64) string {
+	if c.XLog {
+		x = math.Pow(10, x)
+	}
+	return formatChartValue(c.XFormat, x)
+}
+
+// xTicks returns ticks in the scale of x: powers of 10 if XLog, or evenly spaced.
+func (c *lineChart) xTicks(xMin float64, xMax float64) []float64 {
+	var ticks []float64
+	if c.XLog {
+		for x := xMin; x <= xMax; x++ {
+			ticks = append(ticks, x)
+		}
+		return ticks
+	}
+	for i := 0; i <= chartTicks; i++ {
+		ticks = append(ticks, xMin+(xMax-xMin)*float64(i)/chartTicks)
+	}
+	return ticks
+}
+
+type chartBar struct {
+	Label string
+	Value float64
+	Color string
+}
+
+// barChart A chart of bars starting from 0, rendered as inline SVG.
+type barChart struct {
+	Title   string
+	YFormat func(float64) string
+	Bars    []chartBar
+}
+
+// SVG renders the chart.
+func (c *barChart) SVG() template.HTML {
+	var svg strings.Builder
+	writeChartHeader(&svg, c.Title, "", "", nil)
+
+	yMax := 0.0
+	for _, bar := range c.Bars {
+		yMax = math.Max(yMax, bar.Value)
+	}
+	_, yMax = chartRange(0, yMax)
+
+	left, right := float64(chartMarginLeft), float64(chartWidth-chartMarginRight)
+	top, bottom := float64(chartMarginTop), float64(chartHeight-chartMarginBottom)
+	py := func(y float64) float64 { return bottom - y/yMax*(bottom-top) }
+
+	for i := 0; i <= chartTicks; i++ {
+		y := yMax * float64(i) / chartTicks
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, left, py(y), right, py(y))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="end" font-size="11">%s</text>`, left-6, py(y)+4, template.HTMLEscapeString(formatChartValue(c.YFormat, y)))
+	}
+	fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="#999"/>`, left, top, right-left, bottom-top)
+
+	if len(c.Bars) > 0 {
+		slot := (right - left) / float64(len(c.Bars))
+		width := slot * 0.6
+		for i, bar := range c.Bars {
+			x := left + slot*float64(i) + (slot-width)/2
+			fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+				x, py(bar.Value), width, bottom-py(bar.Value), bar.Color, template.HTMLEscapeString(bar.Label), template.HTMLEscapeString(formatChartValue(c.YFormat, bar.Value)))
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="11">%s</text>`, x+width/2, bottom+16, template.HTMLEscapeString(bar.Label))
+		}
+	}
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+// writeChartHeader writes the opening tag, the title, labels of axes and the legend of series.
+func writeChartHeader(svg *strings.Builder, title string, xLabel string, yLabel string, series []*chartSeries) {
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(svg, `<text x="%d" y="20" text-anchor="middle" font-size="14" font-weight="bold">%s</text>`, chartWidth/2, template.HTMLEscapeString(title))
+	if xLabel != "" {
+		fmt.Fprintf(svg, `<text x="%d" y="%d" text-anchor="middle" font-size="12">%s</text>`, (chartWidth+chartMarginLeft-chartMarginRight)/2, chartHeight-8, template.HTMLEscapeString(xLabel))
+	}
+	if yLabel != "" {
+		fmt.Fprintf(svg, `<text x="14" y="%d" text-anchor="middle" font-size="12" transform="rotate(-90 14 %d)">%s</text>`,
+			(chartHeight+chartMarginTop-chartMarginBottom)/2, (chartHeight+chartMarginTop-chartMarginBottom)/2, template.HTMLEscapeString(yLabel))
+	}
+	x := chartMarginLeft
+	for _, s := range series {
+		fmt.Fprintf(svg, `<rect x="%d" y="32" width="10" height="10" fill="%s"/><text x="%d" y="41" font-size="11">%s</text>`, x, s.Color, x+14, template.HTMLEscapeString(s.Name))
+		x += 24 + 7*len(s.Name)
+	}
+}
+
+// chartRange returns the range of values, widened if empty.
+func chartRange(min float64, max float64) (float64, float64) {
+	if max > min {
+		return min, max
+	} else if max == 0 {
+		return 0, 1
+	}
+	return min - math.Abs(min)*0.5, max + math.Abs(max)*0.5
+}
+
+func formatChartValue(format func(float64) string, v float64) string {
+	if format == nil {
+		return strconv.FormatFloat(v, 'g', 4, 64)
+	}
+	return format(v)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sionreview/sionreplayer/benchclient"
+)
+
+const (
+	IntervalClockWall  = "wall"  // Intervals of the time elapsed.
+	IntervalClockTrace = "trace" // Intervals of the time in the trace, e.g. fast forwarded in compact mode.
+
+	IntervalHeader = "interval,start,end,requests,throughput,gets,hits,misses,hitRatio,sets,errors,bytes,bandwidth,concurrency,lagP50,lagP99,latencyP50,latencyP90,latencyP99,latencyMax"
+)
+
+var (
+	ErrInvalidIntervalClock = errors.New("invalid interval clock, expecting wall or trace")
+)
+
+// Interval Stats of requests completed in an interval. Times are relative to the start of the replay.
+type Interval struct {
+	Seq         int
+	Start       time.Duration
+	End         time.Duration
+	Requests    int64
+	Gets        int64
+	Hits        int64
+	Misses      int64
+	Sets        int64
+	Errors      int64
+	Bytes       uint64 // Bytes of objects read or written successfully.
+	Concurrency int32  // Requests in flight at the end of the interval.
+	Lag         *benchclient.Histogram
+	Latency     *benchclient.Histogram
+}
+
+func newInterval(seq int, start time.Duration) *Interval {
+	return &Interval{
+		Seq:     seq,
+		Start:   start,
+		Lag:     benchclient.NewHistogram(),
+		Latency: benchclient.NewHistogram(),
+	}
+}
+
+// Throughput returns requests per second.
+func (i *Interval) Throughput() float64 {
+	return ratio(float64(i.Requests), (i.End - i.Start).Seconds())
+}
+
+// Bandwidth returns bytes per second.
+func (i *Interval) Bandwidth() float64 {
+	return ratio(float64(i.Bytes), (i.End - i.Start).Seconds())
+}
+
+// HitRatio returns the ratio of gets succeeded in [0, 1].
+func (i *Interval) HitRatio() float64 {
+	return ratio(float64(i.Hits), float64(i.Gets))
+}
+
+func (i *Interval) String() string {
+	return fmt.Sprintf("Interval %d [%v, %v): %d requests (%.1f/s), gets %d, hit ratio %.2f%%, sets %d, errors %d, %s (%s/s), concurrency %d, lag p50/p99 %v/%v, latency p50/p90/p99/max %v/%v/%v/%v",
+		i.Seq, i.Start, i.End, i.Requests, i.Throughput(), i.Gets, i.HitRatio()*100, i.Sets, i.Errors,
+		humanize.Bytes(i.Bytes), humanize.Bytes(uint64(i.Bandwidth())), i.Concurrency,
+		i.Lag.PercentileDuration(50), i.Lag.PercentileDuration(99),
+		i.Latency.PercentileDuration(50), i.Latency.PercentileDuration(90), i.Latency.PercentileDuration(99), time.Duration(i.Latency.Max()))
+}
+
+// appendCSV appends the CSV line of the interval. Times are in nanoseconds.
+func (i *Interval) appendCSV(buf []byte) []byte {
+	buf = strconv.AppendInt(buf, int64(i.Seq), 10)
+	for _, v := range []int64{int64(i.Start), int64(i.End), i.Requests} {
+		buf = append(buf, ',')
+		buf = strconv.AppendInt(buf, v, 10)
+	}
+	buf = append(buf, ',')
+	buf = strconv.AppendFloat(buf, i.Throughput(), 'f', 3, 64)
+	for _, v := range []int64{i.Gets, i.Hits, i.Misses} {
+		buf = append(buf, ',')
+		buf = strconv.AppendInt(buf, v, 10)
+	}
+	buf = append(buf, ',')
+	buf = strconv.AppendFloat(buf, i.HitRatio(), 'f', 4, 64)
+	for _, v := range []int64{i.Sets, i.Errors, int64(i.Bytes)} {
+		buf = append(buf, ',')
+		buf = strconv.AppendInt(buf, v, 10)
+	}
+	buf = append(buf, ',')
+	buf = strconv.AppendFloat(buf, i.Bandwidth(), 'f', 0, 64)
+	for _, v := range []int64{int64(i.Concurrency), i.Lag.Percentile(50), i.Lag.Percentile(99),
+		i.Latency.Percentile(50), i.Latency.Percentile(90), i.Latency.Percentile(99), i.Latency.Max()} {
+		buf = append(buf, ',')
+		buf = strconv.AppendInt(buf, v, 10)
+	}
+	return append(buf, '\n')
+}
+
+// IntervalOptions Options of interval reporting.
+type IntervalOptions struct {
+	// Period The length of intervals.
+	Period time.Duration
+
+	// Clock IntervalClockWall or IntervalClockTrace.
+	Clock string
+
+	// Stdout Where intervals are printed, nil to disable.
+	Stdout io.Writer
+
+	// File The path of the CSV time series, empty to disable.
+	File string
+
+	// Concurrency Returns requests in flight.
+	Concurrency func() int32
+}
+
+// IntervalStats Reports stats of requests completed in each interval of the wall or trace time.
+type IntervalStats struct {
+	opts      IntervalOptions
+	current   *Interval
+	traceTime time.Duration // The trace time of the last request scheduled.
+	file      *os.File
+	w         *bufio.Writer
+	buf       []byte
+	done      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+}
+
+// ValidateIntervalClock returns the clock validated, an empty clock is IntervalClockWall.
+func ValidateIntervalClock(clock string) (string, error) {
+	switch clock {
+	case "":
+		return IntervalClockWall, nil
+	case IntervalClockWall, IntervalClockTrace:
+		return clock, nil
+	default:
+		return clock, ErrInvalidIntervalClock
+	}
+}
+
+func NewIntervalStats(opts IntervalOptions) (*IntervalStats, error) {
+	var err error
+	if opts.Clock, err = ValidateIntervalClock(opts.Clock); err != nil {
+		return nil, err
+	}
+
+	stats := &IntervalStats{opts: opts, current: newInterval(0, 0), done: make(chan struct{})}
+	if opts.File != "" {
+		stats.file, err = os.Create(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		stats.w = bufio.NewWriter(stats.file)
+		stats.w.WriteString(IntervalHeader)
+		stats.w.WriteByte('\n')
+	}
+	return stats, nil
+}
+
+// Start starts the clock of the wall time.
+func (s *IntervalStats) Start(start time.Time) {
+	if s.opts.Clock != IntervalClockWall {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.opts.Period)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.mu.Lock()
+				s.flushLocked(now.Sub(start))
+				s.mu.Unlock()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Advance advances the clock of the trace time to the time a request scheduled.
+func (s *IntervalStats) Advance(traceTime time.Duration) {
+	if s.opts.Clock != IntervalClockTrace {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if traceTime > s.traceTime {
+		s.traceTime = traceTime
+	}
+	for traceTime >= s.current.Start+s.opts.Period {
+		s.flushLocked(s.current.Start + s.opts.Period)
+	}
+}
+
+// Record adds the request completed to the current interval.
+func (s *IntervalStats) Record(result *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	interval := s.current
+	interval.Requests++
+	switch result.Op {
+	case "get":
+		interval.Gets++
+		if result.Result == PerformResultSuccess {
+			interval.Hits++
+		} else if result.Result == PerformResultNotFound {
+			interval.Misses++
+		}
+	case "set":
+		interval.Sets++
+	}
+	if result.Result == PerformResultError {
+		interval.Errors++
+	} else if result.Result == PerformResultSuccess {
+		interval.Bytes += result.Size
+	}
+	interval.Lag.RecordDuration(result.Lag())
+	interval.Latency.RecordDuration(result.Latency)
+}
+
+// Close reports the last interval, ended at the time elapsed or the trace time of the last request scheduled.
+func (s *IntervalStats) Close(end time.Duration) error {
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opts.Clock == IntervalClockTrace {
+		end = s.traceTime
+	}
+	if s.current.Requests > 0 {
+		if end <= s.current.Start {
+			end = s.current.Start + s.opts.Period
+		}
+		s.flushLocked(end)
+	}
+	if s.file == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *IntervalStats) flushLocked(end time.Duration) {
+	interval := s.current
+	interval.End = end
+	if s.opts.Concurrency != nil {
+		interval.Concurrency = s.opts.Concurrency()
+	}
+	if s.opts.Stdout != nil {
+		fmt.Fprintln(s.opts.Stdout, interval)
+	}
+	if s.w != nil {
+		s.buf = interval.appendCSV(s.buf[:0])
+		s.w.Write(s.buf)
+	}
+	s.current = newInterval(interval.Seq+1, end)
+}
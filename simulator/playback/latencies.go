@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sionreview/sion/client"
+	"github.com/sionreview/sionreplayer/benchclient"
+)
+
+const (
+	LatencyOpGet      = "get"
+	LatencyOpSet      = "set"
+	LatencyOpReset    = "reset"    // Refilling the main service on a miss.
+	LatencyOpFailover = "failover" // Reading the failover service on a miss.
+
+	// ProviderNearCache The provider recorded for gets served by the near cache.
+	ProviderNearCache = "nearcache"
+)
+
+var (
+	LatencyOps         = []string{LatencyOpGet, LatencyOpSet, LatencyOpReset, LatencyOpFailover}
+	LatencyPercentiles = []float64{50, 90, 99, 99.9}
+
+	// LatencySizeBuckets Upper bounds of object sizes, objects larger than the last bound fall in an extra bucket.
+	LatencySizeBuckets = []uint64{64 * 1024, 1024 * 1024, 16 * 1024 * 1024, 128 * 1024 * 1024}
+)
+
+// SizeBucket returns the label of the bucket of the object size, e.g. "<=1.0 MiB".
+func SizeBucket(size uint64) string {
+	for _, bound := range LatencySizeBuckets {
+		if size <= bound {
+			return "<=" + humanize.IBytes(bound)
+		}
+	}
+	return ">" + humanize.IBytes(LatencySizeBuckets[len(LatencySizeBuckets)-1])
+}
+
+// LatencyKey Dimensions of latencies recorded.
+type LatencyKey struct {
+	Op       string `json:"op"`
+	Provider string `json:"provider"`
+	Result   string `json:"result"`
+	Size     string `json:"size"`
+}
+
+// LatencySnapshot The serializable form of a histogram of latencies.
+type LatencySnapshot struct {
+	LatencyKey
+	Histogram *benchclient.HistogramSnapshot `json:"histogram"`
+}
+
+// LatencyHistograms Histograms of latencies in nanoseconds by operation, provider, result and size bucket.
+// Histograms of multiple runs can be merged using snapshots.
+type LatencyHistograms struct {
+	histograms map[LatencyKey]*benchclient.Histogram
+	mu         sync.RWMutex
+}
+
+func NewLatencyHistograms() *LatencyHistograms {
+	return &LatencyHistograms{histograms: make(map[LatencyKey]*benchclient.Histogram)}
+}
+
+// ResultOf returns the result of the error returned by a client.
+func ResultOf(err error) int {
+	switch err {
+	case nil:
+		return PerformResultSuccess
+	case client.ErrNotFound:
+		return PerformResultNotFound
+	default:
+		return PerformResultError
+	}
+}
+
+// Record records the latency of an operation on the object of the size.
+func (h *LatencyHistograms) Record(op string, provider string, result int, size uint64, latency time.Duration) {
+	h.histogram(LatencyKey{Op: op, Provider: provider, Result: ResultName(result), Size: SizeBucket(size)}).RecordDuration(latency)
+}
+
+// Since records the latency since the start.
+func (h *LatencyHistograms) Since(op string, provider string, err error, size uint64, start time.Time) {
+	h.Record(op, provider, ResultOf(err), size, time.Since(start))
+}
+
+func (h *LatencyHistograms) histogram(key LatencyKey) *benchclient.Histogram {
+	h.mu.RLock()
+	histogram, ok := h.histograms[key]
+	h.mu.RUnlock()
+	if ok {
+		return histogram
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if histogram, ok = h.histograms[key]; !ok {
+		histogram = benchclient.NewHistogram()
+		h.histograms[key] = histogram
+	}
+	return histogram
+}
+
+// Keys returns keys of histograms recorded, sorted by operation, provider, result and size.
+func (h *LatencyHistograms) Keys() []LatencyKey {
+	h.mu.RLock()
+	keys := make([]LatencyKey, 0, len(h.histograms))
+	for key := range h.histograms {
+		keys = append(keys, key)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Op != keys[j].Op {
+			return latencyOpOrder(keys[i].Op) < latencyOpOrder(keys[j].Op)
+		} else if keys[i].Provider != keys[j].Provider {
+			return keys[i].Provider < keys[j].Provider
+		} else if keys[i].Result != keys[j].Result {
+			return latencyResultOrder(keys[i].Result) < latencyResultOrder(keys[j].Result)
+		}
+		return sizeBucketOrder(keys[i].Size) < sizeBucketOrder(keys[j].Size)
+	})
+	return keys
+}
+
+// Filter returns a histogram merging histograms of keys matched.
+func (h *LatencyHistograms) Filter(match func(LatencyKey) bool) *benchclient.Histogram {
+	merged := benchclient.NewHistogram()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for key, histogram := range h.histograms {
+		if match(key) {
+			merged.Merge(histogram)
+		}
+	}
+	return merged
+}
+
+// MergeSnapshots adds latencies in the snapshots, e.g. ones loaded from another run.
+func (h *LatencyHistograms) MergeSnapshots(snapshots []*LatencySnapshot) {
+	for _, snapshot := range snapshots {
+		h.histogram(snapshot.LatencyKey).MergeSnapshot(snapshot.Histogram)
+	}
+}
+
+// Snapshots returns snapshots of histograms, sorted by keys.
+func (h *LatencyHistograms) Snapshots() []*LatencySnapshot {
+	keys := h.Keys()
+	snapshots := make([]*LatencySnapshot, len(keys))
+	for i, key := range keys {
+		snapshots[i] = &LatencySnapshot{LatencyKey: key, Histogram: h.histogram(key).Snapshot()}
+	}
+	return snapshots
+}
+
+// Save writes snapshots to the file as JSON.
+func (h *LatencyHistograms) Save(path string) error {
+	data, err := json.MarshalIndent(h.Snapshots(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadLatencyHistograms merges histograms saved by runs with -latencies.
+func LoadLatencyHistograms(paths ...string) (*LatencyHistograms, error) {
+	h := NewLatencyHistograms()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var snapshots []*LatencySnapshot
+		if err := json.Unmarshal(data, &snapshots); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		h.MergeSnapshots(snapshots)
+	}
+	return h, nil
+}
+
+// Summary returns lines of percentiles by operation, provider and result, followed by lines of size buckets.
+func (h *LatencyHistograms) Summary() []string {
+	var lines []string
+	var last LatencyKey
+	for _, key := range h.Keys() {
+		if key.Op != last.Op || key.Provider != last.Provider || key.Result != last.Result {
+			last = key
+			all := h.Filter(func(other LatencyKey) bool {
+				return other.Op == key.Op && other.Provider == key.Provider && other.Result == key.Result
+			})
+			lines = append(lines, fmt.Sprintf("%s %s %s: %s", key.Op, key.Provider, key.Result, FormatPercentiles(all)))
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", key.Size, FormatPercentiles(h.histogram(key))))
+	}
+	return lines
+}
+
+// FormatPercentiles returns the count and p50/p90/p99/p999/max of latencies in the histogram.
+func FormatPercentiles(histogram *benchclient.Histogram) string {
+	ret := fmt.Sprintf("%d, p50/p90/p99/p999/max", histogram.Count())
+	for i, p := range LatencyPercentiles {
+		sep := " "
+		if i > 0 {
+			sep = "/"
+		}
+		ret += sep + histogram.PercentileDuration(p).String()
+	}
+	return ret + "/" + time.Duration(histogram.Max()).String()
+}
+
+func latencyOpOrder(op string) int {
+	for i, known := range LatencyOps {
+		if op == known {
+			return i
+		}
+	}
+	return len(LatencyOps)
+}
+
+func latencyResultOrder(result string) int {
+	for i, known := range PerformResultNames {
+		if result == known {
+			return i
+		}
+	}
+	return len(PerformResultNames)
+}
+
+func sizeBucketOrder(bucket string) int {
+	for i, bound := range LatencySizeBuckets {
+		if bucket == "<="+humanize.IBytes(bound) {
+			return i
+		}
+	}
+	return len(LatencySizeBuckets)
+}
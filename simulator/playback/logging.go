@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mason-leap-lab/go-utils/logger"
+)
+
+const (
+	LogSchedule = "schedule" // Scheduling and skipping records in the main loop.
+	LogDispatch = "dispatch" // Dispatching and completing requests.
+	LogPerform  = "perform"  // Operations in perform().
+
+	// LogAll Sets the sampling of all categories.
+	LogAll = "all"
+
+	LogSamplingOff = "off"
+
+	logTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var (
+	LogCategories = []string{LogSchedule, LogDispatch, LogPerform}
+
+	ErrInvalidLogSampling = errors.New("invalid log sampling, expecting category=N for 1 in N lines, category=K/s for at most K lines per second, or category=off")
+)
+
+// LogSampler Samples lines of a category, either 1 in Every lines or at most PerSecond lines per second. No line is
+// sampled if neither is set.
+type LogSampler struct {
+	Every      uint64
+	PerSecond  int64
+	Suppressed uint64
+
+	seen  uint64
+	state uint64 // The second counted in the high 32 bits, and lines sampled in the second in the low 32 bits.
+}
+
+// ParseLogSampler parses the sampling of a category: "N", "K/s" or "off".
+func ParseLogSampler(spec string) (*LogSampler, error) {
+	if spec == LogSamplingOff {
+		return &LogSampler{}, nil
+	} else if strings.HasSuffix(spec, "/s") {
+		perSecond, err := strconv.ParseInt(strings.TrimSuffix(spec, "/s"), 10, 64)
+		if err != nil || perSecond <= 0 {
+			return nil, ErrInvalidLogSampling
+		}
+		return &LogSampler{PerSecond: perSecond}, nil
+	}
+
+	every, err := strconv.ParseUint(spec, 10, 64)
+	if err != nil || every == 0 {
+		return nil, ErrInvalidLogSampling
+	}
+	return &LogSampler{Every: every}, nil
+}
+
+// Sample returns true if the line should be logged.
+func (s *LogSampler) Sample() bool {
+	sampled := false
+	if s.Every > 0 {
+		sampled = (atomic.AddUint64(&s.seen, 1)-1)%s.Every == 0
+	} else if s.PerSecond > 0 {
+		// The window is reset and counted in one CAS, so no line is lost on resets.
+		now := uint64(uint32(time.Now().Unix()))
+		for {
+			state := atomic.LoadUint64(&s.state)
+			count := state & math.MaxUint32
+			if state>>32 != now {
+				count = 0
+			}
+			if int64(count) >= s.PerSecond {
+				break
+			} else if atomic.CompareAndSwapUint64(&s.state, state, now<<32|(count+1)) {
+				sampled = true
+				break
+			}
+		}
+	}
+	if !sampled {
+		atomic.AddUint64(&s.Suppressed, 1)
+	}
+	return sampled
+}
+
+func (s *LogSampler) String() string {
+	if s.Every > 0 {
+		return strconv.FormatUint(s.Every, 10)
+	} else if s.PerSecond > 0 {
+		return strconv.FormatInt(s.PerSecond, 10) + "/s"
+	}
+	return LogSamplingOff
+}
+
+// LogSampling Loggers of categories of frequent lines, sampled to reduce the cost of logging. Lines are sampled by level
+// after filtered by the level of the base logger, so lines dropped anyway take no sample. Warnings and errors are never
+// sampled.
+type LogSampling struct {
+	loggers  map[string]logger.Logger
+	samplers map[string][]*LogSampler // Samplers of a category by level: trace, debug and info.
+}
+
+// sampledLogger A logger of a category sampling lines by level.
+type sampledLogger struct {
+	logger.Logger
+	verbose  bool
+	samplers []*LogSampler
+}
+
+func (l *sampledLogger) Trace(format string, args ...interface{}) {
+	if l.verbose && l.GetLevel() <= logger.LOG_LEVEL_ALL && l.samplers[0].Sample() {
+		l.Logger.Trace(format, args...)
+	}
+}
+
+func (l *sampledLogger) Debug(format string, args ...interface{}) {
+	if l.GetLevel() <= logger.LOG_LEVEL_ALL && l.samplers[1].Sample() {
+		l.Logger.Debug(format, args...)
+	}
+}
+
+func (l *sampledLogger) Info(format string, args ...interface{}) {
+	if l.GetLevel() <= logger.LOG_LEVEL_INFO && l.samplers[2].Sample() {
+		l.Logger.Info(format, args...)
+	}
+}
+
+// NewLogSampling creates loggers of categories sampled following the spec like "perform=100,dispatch=10/s". Categories
+// not specified are not sampled.
+func NewLogSampling(spec string, base logger.Logger) (*LogSampling, error) {
+	sampling := &LogSampling{
+		loggers:  make(map[string]logger.Logger, len(LogCategories)),
+		samplers: make(map[string][]*LogSampler, len(LogCategories)),
+	}
+	for _, category := range LogCategories {
+		if fileLogger, ok := base.(*FileLogger); ok {
+			sampling.loggers[category] = fileLogger.WithCategory(category)
+		} else {
+			sampling.loggers[category] = base
+		}
+	}
+
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLogSampling, rule)
+		}
+		category := strings.TrimSpace(kv[0])
+		if _, ok := sampling.loggers[category]; !ok && category != LogAll {
+			return nil, fmt.Errorf("unknown log category %s, valid choices: %s, %s", category, strings.Join(LogCategories, ", "), LogAll)
+		}
+		if _, err := ParseLogSampler(strings.TrimSpace(kv[1])); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, rule)
+		}
+		categories := []string{category}
+		if category == LogAll {
+			categories = LogCategories
+		}
+		for _, category := range categories {
+			// Samplers are created per category and level to be counted separately.
+			samplers := make([]*LogSampler, 3)
+			for i := range samplers {
+				samplers[i], _ = ParseLogSampler(strings.TrimSpace(kv[1]))
+			}
+			sampling.samplers[category] = samplers
+		}
+	}
+
+	verbose := true
+	switch base := base.(type) {
+	case *logger.ColorLogger:
+		verbose = base.Verbose
+	case *FileLogger:
+		verbose = base.Verbose
+	}
+	for category, samplers := range sampling.samplers {
+		sampling.loggers[category] = &sampledLogger{Logger: sampling.loggers[category], verbose: verbose, samplers: samplers}
+	}
+	return sampling, nil
+}
+
+// Logger returns the logger of the category, which samples lines if the category is sampled. The base logger is
+// returned if the sampling is not initialized.
+func (l *LogSampling) Logger(category string) logger.Logger {
+	if l == nil {
+		return log
+	}
+	return l.loggers[category]
+}
+
+// String returns lines suppressed by category, e.g. "perform 1 in 100 (990 suppressed)".
+func (l *LogSampling) String() string {
+	categories := make([]string, 0, len(l.samplers))
+	for category := range l.samplers {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	stats := make([]string, len(categories))
+	for i, category := range categories {
+		suppressed := uint64(0)
+		for _, sampler := range l.samplers[category] {
+			suppressed += atomic.LoadUint64(&sampler.Suppressed)
+		}
+		stats[i] = fmt.Sprintf("%s %s (%d suppressed)", category, l.samplers[category][0], suppressed)
+	}
+	return strings.Join(stats, ", ")
+}
+
+// FileLogger Writes logs to a file in the structured, non-colored form of
+// `time=... level=info category=perform msg="..."`. Warnings and errors are echoed to the terminal if Echo is set.
+type FileLogger struct {
+	Level    int
+	Verbose  bool
+	Category string
+	Echo     logger.Logger
+
+	file *logFile
+}
+
+type logFile struct {
+	file *os.File
+	buf  []byte
+	mu   sync.Mutex
+}
+
+func NewFileLogger(path string, level int, verbose bool) (*FileLogger, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogger{Level: level, Verbose: verbose, file: &logFile{file: file}}, nil
+}
+
+// WithCategory returns a logger sharing the file, with lines tagged by the category.
+func (l *FileLogger) WithCategory(category string) *FileLogger {
+	categorized := *l
+	categorized.Category = category
+	return &categorized
+}
+
+func (l *FileLogger) Trace(format string, args ...interface{}) {
+	if !l.Verbose {
+		return
+	}
+	l.log(logger.LOG_LEVEL_ALL, "trace", format, args...)
+}
+
+func (l *FileLogger) Debug(format string, args ...interface{}) {
+	l.log(logger.LOG_LEVEL_ALL, "debug", format, args...)
+}
+
+func (l *FileLogger) Info(format string, args ...interface{}) {
+	l.log(logger.LOG_LEVEL_INFO, "info", format, args...)
+}
+
+func (l *FileLogger) Warn(format string, args ...interface{}) {
+	l.log(logger.LOG_LEVEL_WARN, "warn", format, args...)
+	if l.Echo != nil {
+		l.Echo.Warn(format, args...)
+	}
+}
+
+func (l *FileLogger) Error(format string, args ...interface{}) {
+	l.log(logger.LOG_LEVEL_NONE, "error", format, args...)
+	if l.Echo != nil {
+		l.Echo.Error(format, args...)
+	}
+}
+
+func (l *FileLogger) GetLevel() int {
+	return l.Level
+}
+
+// Close closes the file shared by loggers of all categories.
+func (l *FileLogger) Close() error {
+	return l.file.file.Close()
+}
+
+func (l *FileLogger) log(threshold int, level string, format string, args ...interface{}) {
+	if l.Level > threshold {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	now := time.Now()
+
+	f := l.file
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	buf := append(f.buf[:0], "time="...)
+	buf = now.AppendFormat(buf, logTimeFormat)
+	buf = append(buf, " level="...)
+	buf = append(buf, level...)
+	if l.Category != "" {
+		buf = append(buf, " category="...)
+		buf = append(buf, l.Category...)
+	}
+	buf = append(buf, " msg="...)
+	buf = strconv.AppendQuote(buf, msg)
+	buf = append(buf, '\n')
+	f.file.Write(buf)
+	f.buf = buf
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sionreview/sionreplayer/simulator/playback/proxy"
+)
+
+const (
+	MetricsPath      = "/metrics"
+	MetricsNamespace = "sionreplayer"
+
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	metricsEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	// MetricsBuckets Upper bounds of latency buckets in seconds.
+	MetricsBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// MetricsHistogram A histogram of durations in seconds with fixed buckets, exposed as a Prometheus histogram.
+type MetricsHistogram struct {
+	counts []int64 // Not cumulative, the last one for values beyond the buckets.
+	total  int64
+	sum    float64
+	mu     sync.Mutex
+}
+
+func NewMetricsHistogram() *MetricsHistogram {
+	return &MetricsHistogram{counts: make([]int64, len(MetricsBuckets)+1)}
+}
+
+func (h *MetricsHistogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	idx := sort.SearchFloat64s(MetricsBuckets, seconds)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[idx]++
+	h.total++
+	h.sum += seconds
+}
+
+// write writes the histogram in the text format. Labels are like `op="get"`, empty if none.
+func (h *MetricsHistogram) write(w io.Writer, name string, labels string) {
+	h.mu.Lock()
+	counts := make([]int64, len(h.counts))
+	copy(counts, h.counts)
+	total, sum := h.total, h.sum
+	h.mu.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	cumulative := int64(0)
+	for i, bound := range MetricsBuckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, total)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(labels), strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braces(labels), total)
+}
+
+type metricsRequestKey struct {
+	op       string
+	result   string
+	provider string
+}
+
+type metricsLatencyKey struct {
+	op       string
+	provider string
+}
+
+// MetricsOptions Sources of gauges sampled on scraping.
+type MetricsOptions struct {
+	// Concurrency Returns requests in flight.
+	Concurrency func() int32
+
+	// Pools Client pools by name.
+	Pools map[string]*proxy.Pool
+
+	// Proxies Simulated proxies, of which the memory of lambdas are exposed.
+	Proxies []*proxy.Proxy
+}
+
+// Metrics Exposes the replay in the Prometheus text format.
+type Metrics struct {
+	opts     MetricsOptions
+	requests map[metricsRequestKey]*int64
+	latency  map[metricsLatencyKey]*MetricsHistogram
+	lag      *MetricsHistogram
+	poolWait *MetricsHistogram
+	mu       sync.RWMutex
+
+	server   *http.Server
+	listener net.Listener
+}
+
+func NewMetrics(opts MetricsOptions) *Metrics {
+	return &Metrics{
+		opts:     opts,
+		requests: make(map[metricsRequestKey]*int64),
+		latency:  make(map[metricsLatencyKey]*MetricsHistogram),
+		lag:      NewMetricsHistogram(),
+		poolWait: NewMetricsHistogram(),
+	}
+}
+
+// Record counts the request completed.
+func (m *Metrics) Record(result *Result) {
+	requestKey := metricsRequestKey{op: result.Op, result: ResultName(result.Result), provider: result.Provider}
+	latencyKey := metricsLatencyKey{op: result.Op, provider: result.Provider}
+
+	m.mu.RLock()
+	counter, counted := m.requests[requestKey]
+	latency, observed := m.latency[latencyKey]
+	m.mu.RUnlock()
+	if !counted || !observed {
+		m.mu.Lock()
+		if counter, counted = m.requests[requestKey]; !counted {
+			counter = new(int64)
+			m.requests[requestKey] = counter
+		}
+		if latency, observed = m.latency[latencyKey]; !observed {
+			latency = NewMetricsHistogram()
+			m.latency[latencyKey] = latency
+		}
+		m.mu.Unlock()
+	}
+
+	atomic.AddInt64(counter, 1)
+	latency.Observe(result.Latency)
+	m.lag.Observe(result.Lag())
+	m.poolWait.Observe(result.PoolWait)
+}
+
+// Listen serves metrics on the address in background, e.g. ":9100".
+func (m *Metrics) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, m)
+	m.listener = listener
+	m.server = &http.Server{Handler: mux}
+	go m.server.Serve(listener)
+	return nil
+}
+
+// Addr returns the address listened.
+func (m *Metrics) Addr() string {
+	if m.listener == nil {
+		return ""
+	}
+	return m.listener.Addr().String()
+}
+
+func (m *Metrics) Close() error {
+	if m.server == nil {
+		return nil
+	}
+	return m.server.Close()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	buffered := bufio.NewWriter(w)
+	m.Export(buffered)
+	buffered.Flush()
+}
+
+// Export writes all metrics in the text format.
+func (m *Metrics) Export(w io.Writer) {
+	m.mu.RLock()
+	requestKeys := make([]metricsRequestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	latencyKeys := make([]metricsLatencyKey, 0, len(m.latency))
+	for key := range m.latency {
+		latencyKeys = append(latencyKeys, key)
+	}
+	m.mu.RUnlock()
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].op != requestKeys[j].op {
+			return latencyOpOrder(requestKeys[i].op) < latencyOpOrder(requestKeys[j].op)
+		} else if requestKeys[i].provider != requestKeys[j].provider {
+			return requestKeys[i].provider < requestKeys[j].provider
+		}
+		return latencyResultOrder(requestKeys[i].result) < latencyResultOrder(requestKeys[j].result)
+	})
+	sort.Slice(latencyKeys, func(i, j int) bool {
+		if latencyKeys[i].op != latencyKeys[j].op {
+			return latencyOpOrder(latencyKeys[i].op) < latencyOpOrder(latencyKeys[j].op)
+		}
+		return latencyKeys[i].provider < latencyKeys[j].provider
+	})
+
+	name := MetricsNamespace + "_requests_total"
+	writeMetricsHeader(w, name, "counter", "Requests replayed by operation, result and provider.")
+	for _, key := range requestKeys {
+		m.mu.RLock()
+		counter := m.requests[key]
+		m.mu.RUnlock()
+		fmt.Fprintf(w, "%s{%s} %d\n", name, metricsLabels("op", key.op, "result", key.result, "provider", key.provider), atomic.LoadInt64(counter))
+	}
+
+	name = MetricsNamespace + "_request_duration_seconds"
+	writeMetricsHeader(w, name, "histogram", "Latencies of requests replayed, including failover reads and resets on misses.")
+	for _, key := range latencyKeys {
+		m.mu.RLock()
+		histogram := m.latency[key]
+		m.mu.RUnlock()
+		histogram.write(w, name, metricsLabels("op", key.op, "provider", key.provider))
+	}
+
+	name = MetricsNamespace + "_scheduling_lag_seconds"
+	writeMetricsHeader(w, name, "histogram", "Delays of dispatching requests against the trace.")
+	m.lag.write(w, name, "")
+
+	name = MetricsNamespace + "_pool_wait_seconds"
+	writeMetricsHeader(w, name, "histogram", "Time waiting for clients of the main pool.")
+	m.poolWait.write(w, name, "")
+
+	if m.opts.Concurrency != nil {
+		name = MetricsNamespace + "_concurrency"
+		writeMetricsHeader(w, name, "gauge", "Requests in flight.")
+		fmt.Fprintf(w, "%s %d\n", name, m.opts.Concurrency())
+	}
+
+	if len(m.opts.Pools) > 0 {
+		pools := make([]string, 0, len(m.opts.Pools))
+		for pool := range m.opts.Pools {
+			pools = append(pools, pool)
+		}
+		sort.Strings(pools)
+
+		capacity := MetricsNamespace + "_pool_capacity"
+		clients := MetricsNamespace + "_pool_clients"
+		writeMetricsHeader(w, capacity, "gauge", "Max clients of client pools.")
+		for _, pool := range pools {
+			fmt.Fprintf(w, "%s{%s} %d\n", capacity, metricsLabels("pool", pool), m.opts.Pools[pool].Stats().Capacity)
+		}
+		writeMetricsHeader(w, clients, "gauge", "Clients of client pools by state, in use or idle.")
+		for _, pool := range pools {
+			stats := m.opts.Pools[pool].Stats()
+			fmt.Fprintf(w, "%s{%s} %d\n", clients, metricsLabels("pool", pool, "state", "inuse"), stats.InUse())
+			fmt.Fprintf(w, "%s{%s} %d\n", clients, metricsLabels("pool", pool, "state", "idle"), stats.Idle)
+		}
+	}
+
+	if len(m.opts.Proxies) > 0 {
+		name = MetricsNamespace + "_lambda_memory_bytes"
+		writeMetricsHeader(w, name, "gauge", "Memory used by simulated lambdas.")
+		for _, prxy := range m.opts.Proxies {
+			for _, lambda := range prxy.Lambdas() {
+				fmt.Fprintf(w, "%s{%s} %d\n", name, metricsLabels("proxy", prxy.Id, "lambda", strconv.FormatUint(lambda.Id, 10)), atomic.LoadUint64(&lambda.MemUsed))
+			}
+		}
+	}
+}
+
+func writeMetricsHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// metricsLabels formats pairs of label names and values, e.g. `op="get",result="success"`.
+func metricsLabels(pairs ...string) string {
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, pairs[i]+`="`+metricsEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
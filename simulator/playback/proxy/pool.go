@@ -9,6 +9,18 @@ var (
 
 type PoolPerformanceOption int
 
+// PoolStats Occupancy of a pool.
+type PoolStats struct {
+	Capacity  int
+	Allocated int // Items created.
+	Idle      int // Items created and not in use.
+}
+
+// InUse returns the number of items in use.
+func (s PoolStats) InUse() int {
+	return s.Allocated - s.Idle
+}
+
 type Pool struct {
 	New      func() interface{}
 	Finalize func(interface{})
@@ -74,6 +86,13 @@ func (p *Pool) Put(i interface{}) {
 	}
 }
 
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStats{Capacity: p.capacity, Allocated: p.allocated, Idle: len(p.pooled)}
+}
+
 func (p *Pool) Close() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -155,6 +155,16 @@ func (p *Proxy) Len() int {
 	return len(p.LambdaPool)
 }
 
+// Lambdas returns a copy of the lambda pool, safe to be iterated while the pool grows.
+func (p *Proxy) Lambdas() []*Lambda {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lambdas := make([]*Lambda, len(p.LambdaPool))
+	copy(lambdas, p.LambdaPool)
+	return lambdas
+}
+
 func (p *Proxy) ValidateLambda(lambdaId uint64) {
 	if int(lambdaId) < len(p.LambdaPool) {
 		return
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sionreview/sionreplayer/benchclient"
+	"github.com/sionreview/sionreplayer/simulator/playback/proxy"
+)
+
+const (
+	// ReportSchema Identifies run reports.
+	ReportSchema = "sionreplayer/report"
+
+	// ReportVersion The version of the report schema. Increase on incompatible changes.
+	ReportVersion = 1
+)
+
+// Report The result of a run. The text summary is derived from the report, and the report is saved as JSON to
+// <file>_report.json if -file is specified.
+type Report struct {
+	Schema    string        `json:"schema"`
+	Version   int           `json:"version"`
+	Start     time.Time     `json:"start"`
+	Elapsed   time.Duration `json:"elapsed"`
+	TraceFile string        `json:"traceFile"`
+	Provider  string        `json:"provider"` // The main service.
+	Options   *Options      `json:"options"`
+
+	// Flags All flags parsed by name, including flags of services.
+	Flags map[string]string `json:"flags,omitempty"`
+
+	Records        int64            `json:"records"`
+	Memory         ReportRange      `json:"memory"` // Memory consumed in total and per lambda, in bytes.
+	Chunks         ReportChunks     `json:"chunks"`
+	Sets           ReportSets       `json:"sets"`
+	Gets           ReportGets       `json:"gets"`
+	ActiveMinutes  int              `json:"activeMinutes"`
+	BalancerCost   time.Duration    `json:"balancerCost"`
+	MaxConcurrency int32            `json:"maxConcurrency"`
+	Clients        int32            `json:"clients"`
+	Proxies        []*ReportProxy   `json:"proxies"`
+	Latencies      []*ReportLatency `json:"latencies"`
+
+	// Optional sections, omitted if the features are disabled.
+	Faults      map[string]string            `json:"faults,omitempty"` // Faults injected by pool.
+	Middlewares *benchclient.MiddlewareStats `json:"middlewares,omitempty"`
+	Mirror      *ReportText                  `json:"mirror,omitempty"`
+	NearCache   *ReportNearCache             `json:"nearCache,omitempty"`
+	Tiers       *benchclient.TieredStats     `json:"tiers,omitempty"`
+	Results     *ReportResults               `json:"results,omitempty"`
+	Spans       *ReportResults               `json:"spans,omitempty"` // Requests of which spans are exported.
+	Verify      *Verifier                    `json:"verify,omitempty"`
+	Services    []string                     `json:"services,omitempty"` // Report() of providers.
+	Reader      []string                     `json:"reader,omitempty"`   // Report() of the trace reader.
+}
+
+// ReportRange Total, min and max of values of lambdas.
+type ReportRange struct {
+	Total uint64 `json:"total"`
+	Min   uint64 `json:"min"`
+	Max   uint64 `json:"max"`
+}
+
+// ReportChunks Chunks of all lambdas. Ratios are in [0, 1].
+type ReportChunks struct {
+	Set       int         `json:"set"`
+	Got       uint64      `json:"got"`
+	Reset     uint64      `json:"reset"`
+	HitRatio  float64     `json:"hitRatio"`
+	PerLambda ReportRange `json:"perLambda"`
+}
+
+type ReportSets struct {
+	Total     int32 `json:"total"`
+	Succeeded int32 `json:"succeeded"`
+}
+
+// ReportGets Gets replayed. Succeeded, Missed and HitRatio are of the backend, excluding gets served by the near cache.
+type ReportGets struct {
+	Total             int32   `json:"total"`
+	Succeeded         int32   `json:"succeeded"`
+	Missed            int32   `json:"missed"`
+	HitRatio          float64 `json:"hitRatio"`
+	NearCacheHits     int32   `json:"nearCacheHits,omitempty"`
+	NearCacheHitRatio float64 `json:"nearCacheHitRatio,omitempty"`
+}
+
+// ReportProxy Stats of a simulated proxy and its lambdas.
+type ReportProxy struct {
+	Id            string          `json:"id"`
+	Memory        uint64          `json:"memory"`
+	Chunks        int             `json:"chunks"`
+	Evicts        int             `json:"evicts"`
+	ActiveMinutes int             `json:"activeMinutes"`
+	BalancerCost  time.Duration   `json:"balancerCost"`
+	Lambdas       []*ReportLambda `json:"lambdas"`
+}
+
+type ReportLambda struct {
+	Id            uint64 `json:"id"`
+	Memory        uint64 `json:"memory"`
+	Capacity      uint64 `json:"capacity"`
+	Chunks        int    `json:"chunks"`
+	Got           uint64 `json:"got"`
+	Reset         uint64 `json:"reset"`
+	ActiveMinutes int    `json:"activeMinutes"`
+}
+
+// ReportLatency Percentiles of a histogram of latencies, with the histogram to be merged with other runs.
+type ReportLatency struct {
+	LatencyKey
+	Count       int64                          `json:"count"`
+	Mean        float64                        `json:"mean"`
+	StdDev      float64                        `json:"stddev"`
+	Percentiles map[string]time.Duration       `json:"percentiles"`
+	Max         time.Duration                  `json:"max"`
+	Histogram   *benchclient.HistogramSnapshot `json:"histogram"`
+}
+
+type ReportText struct {
+	Title string   `json:"title"`
+	Lines []string `json:"lines"`
+}
+
+type ReportNearCache struct {
+	benchclient.LRUStats
+	BytesSaved int64 `json:"bytesSaved"`
+	MainGets   int64 `json:"mainGets"` // Gets sent to the main service.
+}
+
+type ReportResults struct {
+	Path    string `json:"path"`
+	Written int64  `json:"written"`
+	Dropped int64  `json:"dropped"`
+}
+
+func NewReport(options *Options, traceFile string, start time.Time) *Report {
+	return &Report{
+		Schema:    ReportSchema,
+		Version:   ReportVersion,
+		Start:     start,
+		TraceFile: traceFile,
+		Options:   options,
+		Flags:     make(map[string]string),
+		Memory:    ReportRange{Min: math.MaxUint64},
+		Chunks:    ReportChunks{PerLambda: ReportRange{Min: math.MaxUint64}},
+	}
+}
+
+// AddProxy adds stats of the proxy and its lambdas.
+func (r *Report) AddProxy(prxy *proxy.Proxy) {
+	p := &ReportProxy{
+		Id:           prxy.Id,
+		Evicts:       prxy.NumEvicts(),
+		BalancerCost: prxy.BalancerCost,
+		Lambdas:      make([]*ReportLambda, len(prxy.LambdaPool)),
+	}
+	for i, lambda := range prxy.LambdaPool {
+		l := &ReportLambda{
+			Id:            lambda.Id,
+			Memory:        lambda.MemUsed,
+			Capacity:      lambda.Capacity,
+			Chunks:        lambda.NumChunks(),
+			ActiveMinutes: lambda.ActiveMinutes,
+		}
+		for chk := range lambda.AllChunks() {
+			l.Got += chk.Value.(*proxy.Chunk).Freq
+			l.Reset += chk.Value.(*proxy.Chunk).Reset
+		}
+		p.Lambdas[i] = l
+		p.Memory += l.Memory
+		p.Chunks += l.Chunks
+		p.ActiveMinutes += l.ActiveMinutes
+
+		r.Memory.add(l.Memory)
+		r.Chunks.PerLambda.add(uint64(l.Chunks))
+		r.Chunks.Got += l.Got
+		r.Chunks.Reset += l.Reset
+	}
+	for chk := range prxy.AllEvicts() {
+		r.Chunks.Got += chk.Value.(*proxy.Chunk).Freq
+		r.Chunks.Reset += chk.Value.(*proxy.Chunk).Reset
+	}
+	r.Chunks.Set += p.Chunks + p.Evicts
+	r.ActiveMinutes += p.ActiveMinutes
+	r.BalancerCost += p.BalancerCost
+	r.Proxies = append(r.Proxies, p)
+}
+
+// SetLatencies adds percentiles and histograms of latencies.
+func (r *Report) SetLatencies(latencies *LatencyHistograms) {
+	r.Latencies = r.Latencies[:0]
+	for _, snapshot := range latencies.Snapshots() {
+		histogram := snapshot.Histogram.Histogram()
+		latency := &ReportLatency{
+			LatencyKey:  snapshot.LatencyKey,
+			Count:       histogram.Count(),
+			Mean:        histogram.Mean(),
+			StdDev:      histogram.StdDev(),
+			Percentiles: make(map[string]time.Duration, len(LatencyPercentiles)),
+			Max:         time.Duration(histogram.Max()),
+			Histogram:   snapshot.Histogram,
+		}
+		for _, p := range LatencyPercentiles {
+			latency.Percentiles[PercentileName(p)] = histogram.PercentileDuration(p)
+		}
+		r.Latencies = append(r.Latencies, latency)
+	}
+}
+
+// LatencyHistograms restores histograms of latencies in the report.
+func (r *Report) LatencyHistograms() *LatencyHistograms {
+	latencies := NewLatencyHistograms()
+	for _, latency := range r.Latencies {
+		latencies.MergeSnapshots([]*LatencySnapshot{{LatencyKey: latency.LatencyKey, Histogram: latency.Histogram}})
+	}
+	return latencies
+}
+
+// Finish derives ratios after all stats are set.
+func (r *Report) Finish() {
+	if r.Memory.Min == math.MaxUint64 {
+		r.Memory.Min = 0
+	}
+	if r.Chunks.PerLambda.Min == math.MaxUint64 {
+		r.Chunks.PerLambda.Min = 0
+	}
+	r.Chunks.HitRatio = ratio(float64(r.Chunks.Got), float64(r.Chunks.Got+r.Chunks.Reset))
+	r.Gets.HitRatio = ratio(float64(r.Gets.Succeeded), float64(r.Gets.Total-r.Gets.NearCacheHits))
+	r.Gets.NearCacheHitRatio = ratio(float64(r.Gets.NearCacheHits), float64(r.Gets.Total))
+}
+
+// BalancerCostPerRequest returns the balancer cost per record, 0 if no record was replayed.
+func (r *Report) BalancerCostPerRequest() time.Duration {
+	if r.Records <= 0 {
+		return 0
+	}
+	return r.BalancerCost / time.Duration(r.Records)
+}
+
+// Summary returns lines of the text summary.
+func (r *Report) Summary() []string {
+	lines := []string{
+		fmt.Sprintf("Time elpased: %v", r.Elapsed),
+		fmt.Sprintf("Total records: %d", r.Records),
+		fmt.Sprintf("Total memory consumed: %s", humanize.Bytes(r.Memory.Total)),
+		fmt.Sprintf("Memory consumed per lambda: %s - %s", humanize.Bytes(r.Memory.Min), humanize.Bytes(r.Memory.Max)),
+		fmt.Sprintf("Chunks per lambda: %d - %d", r.Chunks.PerLambda.Min, r.Chunks.PerLambda.Max),
+		fmt.Sprintf("Chunks set %d, got %d, reset %d, hit ratio %d%%", r.Chunks.Set, r.Chunks.Got, r.Chunks.Reset, percent(r.Chunks.HitRatio)),
+		fmt.Sprintf("Puts total %d, succeeded %d", r.Sets.Total, r.Sets.Succeeded),
+		fmt.Sprintf("Gets total %d, succeeded %d, miss %d, hit ratio %d%%", r.Gets.Total, r.Gets.Succeeded, r.Gets.Missed, percent(r.Gets.HitRatio)),
+	}
+	if r.Gets.NearCacheHits > 0 {
+		lines[len(lines)-1] = fmt.Sprintf("Gets total %d, near cache hits %d, near cache hit ratio %d%%, backend succeeded %d, miss %d, backend hit ratio %d%%",
+			r.Gets.Total, r.Gets.NearCacheHits, percent(r.Gets.NearCacheHitRatio), r.Gets.Succeeded, r.Gets.Missed, percent(r.Gets.HitRatio))
+	}
+	pools := make([]string, 0, len(r.Faults))
+	for pool := range r.Faults {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	for _, pool := range pools {
+		lines = append(lines, fmt.Sprintf("Faults injected to %s service: %s", pool, r.Faults[pool]))
+	}
+	if r.Middlewares != nil {
+		lines = append(lines, fmt.Sprintf("Middlewares: %v", r.Middlewares))
+	}
+	if r.Mirror != nil {
+		lines = append(lines, r.Mirror.Title+":")
+		lines = append(lines, r.Mirror.Lines...)
+	}
+	if r.NearCache != nil {
+		lines = append(lines, fmt.Sprintf("Near cache %s of %s, hits %d, misses %d, evictions %d, hit ratio %.2f%%, saved %s, gets to the main service %d",
+			humanize.Bytes(uint64(r.NearCache.Size)), humanize.Bytes(uint64(r.NearCache.Capacity)), r.NearCache.Hits, r.NearCache.Misses, r.NearCache.Evictions,
+			(1-r.NearCache.MissRatio())*100, humanize.Bytes(uint64(r.NearCache.BytesSaved)), r.NearCache.MainGets))
+	}
+	if r.Tiers != nil {
+		lines = append(lines, fmt.Sprintf("Tiers (write %s, read repair %v):", r.Options.WritePolicy, r.Options.ReadRepair))
+		lines = append(lines, strings.Split(r.Tiers.String(), "\n")...)
+	}
+	lines = append(lines, "Latencies:")
+	lines = append(lines, r.LatencyHistograms().Summary()...)
+	if r.Results != nil {
+		lines = append(lines, fmt.Sprintf("Results written to %s: %d, dropped %d", r.Results.Path, r.Results.Written, r.Results.Dropped))
+	}
+	if r.Spans != nil {
+		lines = append(lines, fmt.Sprintf("Spans exported to %s: %d requests, dropped %d", r.Spans.Path, r.Spans.Written, r.Spans.Dropped))
+	}
+	if r.Verify != nil {
+		lines = append(lines, fmt.Sprintf("Verified %d, corrupted %d, truncated %d, stale %d", r.Verify.Verified, r.Verify.Corrupted, r.Verify.Truncated, r.Verify.Stale))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Active Minutes %d", r.ActiveMinutes),
+		fmt.Sprintf("BalancerCost: %s(%s per request)", r.BalancerCost, r.BalancerCostPerRequest()),
+		fmt.Sprintf("Max concurrency: %d, clients initialized: %d", r.MaxConcurrency, r.Clients),
+	)
+	lines = append(lines, r.Services...)
+	return append(lines, r.Reader...)
+}
+
+// Save writes the report to the file as JSON.
+func (r *Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadReport reads the report from the JSON file. Reports of newer versions are rejected.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	} else if r.Schema != ReportSchema {
+		return nil, fmt.Errorf("%s: not a run report", path)
+	} else if r.Version > ReportVersion {
+		return nil, fmt.Errorf("%s: unsupported report version %d, expecting %d or earlier", path, r.Version, ReportVersion)
+	}
+	return r, nil
+}
+
+// PercentileName returns the name of the percentile, e.g. p50, p999 for 99.9.
+func PercentileName(p float64) string {
+	return "p" + strings.ReplaceAll(strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", p), "0"), "."), ".", "")
+}
+
+func (r *ReportRange) add(v uint64) {
+	r.Total += v
+	if v < r.Min {
+		r.Min = v
+	}
+	if v > r.Max {
+		r.Max = v
+	}
+}
+
+// ratio returns a / b, 0 if b is 0.
+func ratio(a float64, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+// percent returns the ratio in percentage, rounded down.
+func percent(ratio float64) int {
+	return int(math.Floor(ratio*100 + 1e-9))
+}
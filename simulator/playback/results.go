@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ResultBufferSize Number of results buffered before results are dropped.
+	ResultBufferSize = 10000
+
+	ResultHeader = "seq,key,op,result,size,scheduled,dispatched,lag,latency,poolWait,provider,reqId"
+)
+
+var (
+	PerformResultNames = []string{"success", "error", "notfound"}
+)
+
+// Result The record of a request replayed. Times are relative to the start of the replay, in nanoseconds.
+type Result struct {
+	Seq        int64 // Sequence number in the trace.
+	Key        string
+	Op         string
+	Result     int // One of PerformResultSuccess, PerformResultError, PerformResultNotFound.
+	Size       uint64
+	Scheduled  time.Duration // When the request is scheduled in the trace.
+	Dispatched time.Duration // When the request is actually sent.
+	Latency    time.Duration // Time spent in the services.
+	PoolWait   time.Duration // Time waiting for a client of the main pool.
+	Provider   string
+	ReqId      string
+}
+
+// Lag returns the scheduling lag, the delay of dispatching against the trace.
+func (r *Result) Lag() time.Duration {
+	return r.Dispatched - r.Scheduled
+}
+
+// ResultName returns the name of the result.
+func ResultName(result int) string {
+	if result < 0 || result >= len(PerformResultNames) {
+		return strconv.Itoa(result)
+	}
+	return PerformResultNames[result]
+}
+
+// ResultWriter Writes results to a CSV file in background. Write never blocks the replay: results are dropped if the
+// buffer is full.
+type ResultWriter struct {
+	Written int64
+	Dropped int64
+
+	file    *os.File
+	w       *bufio.Writer
+	results chan *Result
+	done    sync.WaitGroup
+	err     error
+}
+
+func NewResultWriter(path string) (*ResultWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ResultWriter{
+		file:    file,
+		w:       bufio.NewWriter(file),
+		results: make(chan *Result, ResultBufferSize),
+	}
+	w.w.WriteString(ResultHeader)
+	w.w.WriteByte('\n')
+	w.done.Add(1)
+	go w.serve()
+	return w, nil
+}
+
+// Write queues the result, or drops it if the buffer is full.
+func (w *ResultWriter) Write(result *Result) {
+	select {
+	case w.results <- result:
+	default:
+		atomic.AddInt64(&w.Dropped, 1)
+	}
+}
+
+// Close writes results queued and closes the file.
+func (w *ResultWriter) Close() error {
+	close(w.results)
+	w.done.Wait()
+	if err := w.w.Flush(); w.err == nil {
+		w.err = err
+	}
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func (w *ResultWriter) serve() {
+	defer w.done.Done()
+
+	buf := make([]byte, 0, 256)
+	for result := range w.results {
+		if w.err != nil {
+			continue
+		}
+
+		buf = strconv.AppendInt(buf[:0], result.Seq, 10)
+		buf = append(buf, ',')
+		buf = appendCSVField(buf, result.Key)
+		buf = append(buf, ',')
+		buf = append(buf, result.Op...)
+		buf = append(buf, ',')
+		buf = append(buf, ResultName(result.Result)...)
+		buf = append(buf, ',')
+		buf = strconv.AppendUint(buf, result.Size, 10)
+		for _, d := range []time.Duration{result.Scheduled, result.Dispatched, result.Lag(), result.Latency, result.PoolWait} {
+			buf = append(buf, ',')
+			buf = strconv.AppendInt(buf, int64(d), 10)
+		}
+		buf = append(buf, ',')
+		buf = append(buf, result.Provider...)
+		buf = append(buf, ',')
+		buf = appendCSVField(buf, result.ReqId)
+		buf = append(buf, '\n')
+		if _, err := w.w.Write(buf); err != nil {
+			w.err = err
+			continue
+		}
+		atomic.AddInt64(&w.Written, 1)
+	}
+}
+
+// appendCSVField appends the field, quoted if necessary.
+func appendCSVField(buf []byte, field string) []byte {
+	needsQuote := false
+	for i := 0; i < len(field); i++ {
+		if c := field[i]; c == ',' || c == '"' || c == '\n' || c == '\r' {
+			needsQuote = true
+			break
+		}
+	}
+	if !needsQuote {
+		return append(buf, field...)
+	}
+
+	buf = append(buf, '"')
+	for i := 0; i < len(field); i++ {
+		if field[i] == '"' {
+			buf = append(buf, '"')
+		}
+		buf = append(buf, field[i])
+	}
+	return append(buf, '"')
+}
@@ -26,8 +26,6 @@ import (
 	"fmt"
 	"io"
 	syslog "log"
-	"math"
-	"math/rand"
 	"os"
 	"os/signal"
 	"strconv"
@@ -61,14 +59,23 @@ const (
 )
 
 var (
-	log = &logger.ColorLogger{
+	colorLog = &logger.ColorLogger{
 		Verbose: true,
 		Level:   logger.LOG_LEVEL_ALL,
 		Color:   true,
 	}
+	log                       logger.Logger = colorLog
+	logSampling               *LogSampling
 	clientPools               []*proxy.Pool
+	tieredOptions             benchclient.TieredOptions
+	tieredStats               *benchclient.TieredStats
+	nearCacheStats            *benchclient.NearCacheStats
+	nearCacheOptions          *benchclient.NearCacheOptions
+	verifier                  *Verifier
+	latencies                 = NewLatencyHistograms()
 	numClients                int32
 	keySets, keyGets, keyMiss int32
+	keyNearCacheHits          int32
 	sets, gets                int32
 )
 
@@ -82,9 +89,11 @@ type Options struct {
 	Datashard        int
 	Parityshard      int
 	ECmaxgoroutine   int
+	ErasureCode      bool
+	ErasureBackends  int
 	CSV              bool
-	Stdout           io.Writer
-	Stderr           io.Writer
+	Stdout           io.Writer `json:"-"`
+	Stderr           io.Writer `json:"-"`
 	NoDebug          bool
 	SummaryOnly      bool
 	File             string
@@ -97,11 +106,16 @@ type Options struct {
 	Limit            int64
 	LimitHour        int64
 	Skip             int64
-	S3               string
-	Redis            string
-	RedisCluster     int
-	Dummy            bool
+	Faults           string
+	FailoverFaults   string
+	Retry            benchclient.RetryOptions
+	Hedge            string
+	NearCache        int64
+	Provider         string
 	Failover         string
+	Mirror           string
+	WritePolicy      string
+	ReadRepair       bool
 	Balance          bool
 	Concurrency      int
 	Bandwidth        int64
@@ -110,10 +124,38 @@ type Options struct {
 	SampleKey        uint64
 	FunctionCapacity uint64
 	FunctionOverhead uint64
+	Verify           bool
+	Results          string
+	Latencies        string
+	Interval         time.Duration
+	IntervalClock    string
+	IntervalFile     string
+	Metrics          string
+	Spans            string
+	LogSample        string
+	LogFile          string
+	SpanRate         float64
+	SpanSlow         time.Duration
+}
+
+// payloadReader returns the payload as a reader, or nil if no payload.
+func payloadReader(payload *benchclient.Payload) client.ReadAllCloser {
+	if payload == nil {
+		return nil
+	}
+	return payload
 }
 
 type NanoLogProvider func(func(nanolog.Handle, ...interface{}) error)
 
+// And returns a provider setting the logger of both providers.
+func (p NanoLogProvider) And(other NanoLogProvider) NanoLogProvider {
+	return func(l func(nanolog.Handle, ...interface{}) error) {
+		p(l)
+		other(l)
+	}
+}
+
 type FinalizeOptions struct {
 	once         sync.Once
 	closeNanolog bool
@@ -133,61 +175,111 @@ func (h hasher) Sum64(data []byte) uint64 {
 	return xxhash.Sum64(data)
 }
 
-func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object) (string, string, int) {
+// perform replays the request of the object, and returns the operation, the request id, the result, and the provider
+// that answered. Operations on services are recorded to spans, which can be nil.
+func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object, spans *RequestSpans) (string, string, int, string) {
 	dryrun := 0
 	if opts.Dryrun {
 		dryrun = opts.Cluster
 		if !opts.Compact && obj.Estimation > time.Duration(0) {
-			log.Debug("Sleep %v to simulate processing %s: ", obj.Estimation, obj.Key)
+			logSampling.Logger(LogPerform).Debug("Sleep %v to simulate processing %s: ", obj.Estimation, obj.Key)
 			time.Sleep(obj.Estimation)
 		}
 	}
 
+	// The main client is the cache tier, and the failover is the origin tier.
+	tier := benchclient.NewTiered(cli, tieredOptions, tieredStats)
+
 	// log.Debug("Key:", obj.Key, "mapped to Proxy:", p.Id)
 	if placements, seen := p.Placements(obj.Key); seen {
 		atomic.AddInt32(&gets, 1)
 		// placements can only be empty if dryrun is true and specific balancer is used (e.g., proxy.LRUPlacer)
 		if placements != nil {
-			log.Trace("Found placements of %v: %v", obj.Key, placements)
+			logSampling.Logger(LogPerform).Trace("Found placements of %v: %v", obj.Key, placements)
 		}
 
-		reqId, reader, err := cli.EcGet(obj.Key, dryrun)
-		if opts.Dryrun && opts.Balance {
-			// Validate the result on dryrun.
-			success := placements != nil && p.Validate(obj)
-			if !success {
-				err = client.ErrNotFound
-				log.Warn("Not found due to eviction: %v", obj.Key)
+		// Hits on dryrun are validated before being counted.
+		validate := func(reader client.ReadAllCloser, err error) error {
+			if !opts.Dryrun {
+				return err
+			} else if opts.Balance {
+				if placements == nil || !p.Validate(obj) {
+					log.Warn("Not found due to eviction: %v", obj.Key)
+					return client.ErrNotFound
+				}
+			} else if placements == nil && tier.Policy() == benchclient.WriteAround {
+				// Objects written around are not cached until repaired.
+				return client.ErrNotFound
+			}
+			return err
+		}
+		getStart := time.Now()
+		reqId, reader, err := tier.GetCacheValidated(obj.Key, validate, dryrun)
+		if benchclient.IsNearCacheHit(reader) {
+			latencies.Since(LatencyOpGet, ProviderNearCache, nil, obj.Size, getStart)
+			spans.Since(LatencyOpGet, ProviderNearCache, nil, getStart)
+			// Served in process, the backend is not accessed.
+			if verifier != nil {
+				verifier.Verify(reqId, obj.Key, int(obj.Size), reader)
 			}
+			reader.Close()
+			atomic.AddInt32(&keyNearCacheHits, 1)
+			logSampling.Logger(LogPerform).Trace("Get %s from the near cache.", obj.Key)
+			return "get", reqId, PerformResultSuccess, ProviderNearCache
 		}
+		latencies.Since(LatencyOpGet, tieredStats.Cache.Name, err, obj.Size, getStart)
+		spans.Since(LatencyOpGet, tieredStats.Cache.Name, err, getStart)
 
 		if err == client.ErrNotFound {
 			atomic.AddInt32(&keyMiss, 1)
-			var val []byte
-			if len(clientPools) > 1 {
-				cli := clientPools[1].Get().(benchclient.Client)
-				_, reader, _ := cli.EcGet(obj.Key, dryrun)
+			recovered := false
+			provider := tieredStats.Cache.Name
+			if tier.HasOrigin() {
+				failoverStart := time.Now()
+				_, reader, err := tier.GetOrigin(obj.Key, dryrun)
+				latencies.Since(LatencyOpFailover, tieredStats.Origin.Name, err, obj.Size, failoverStart)
+				spans.Since(LatencyOpFailover, tieredStats.Origin.Name, err, failoverStart)
+				if err != nil && err != client.ErrNotFound {
+					log.Warn("Failed to read %s from the origin: %v", obj.Key, err)
+				}
 				if reader != nil {
-					val, _ = reader.ReadAll()
+					recovered = true
+					provider = tieredStats.Origin.Name
 					reader.Close()
 				}
-				clientPools[1].Put(cli)
+			}
+			if !tier.ReadRepair() {
+				if placements == nil {
+					// Release requests waiting for placements.
+					p.ClearPlacements(obj.Key)
+				}
+				return "get", reqId, PerformResultNotFound, provider
 			}
 
-			if val == nil && !opts.Lean {
-				log.Warn("Regenerate %d bytes object", obj.Size)
-				val = make([]byte, obj.Size)
-				rand.Read(val)
+			// Payloads are deterministic, the object read from failover can be regenerated without being stored.
+			var payload *benchclient.Payload
+			if !opts.Lean {
+				if !recovered {
+					log.Warn("Regenerate %d bytes object", obj.Size)
+				}
+				payload = newPayload(obj)
 			}
 			resetPlacements32 := make([]int, opts.Datashard+opts.Parityshard)
 			for i := 0; i < len(placements); i++ {
 				resetPlacements32[i] = int(placements[i])
 			}
-			_, err := cli.EcSet(obj.Key, val, dryrun, resetPlacements32, "Reset")
+			resetStart := time.Now()
+			_, err := tier.SetCache(obj.Key, payloadReader(payload), dryrun, resetPlacements32, "Reset")
+			latencies.Since(LatencyOpReset, tieredStats.Cache.Name, err, obj.Size, resetStart)
+			spans.Since(LatencyOpReset, tieredStats.Cache.Name, err, resetStart)
 			// Reset is designed for caching system in normal(playback) mode.
 			// Only one of concurrent Reset requests is expected to success.
 			if err == nil {
-				log.Trace("Reset %s.", obj.Key)
+				logSampling.Logger(LogPerform).Trace("Reset %s.", obj.Key)
+				tier.Repaired()
+				if verifier != nil {
+					verifier.Commit(payload)
+				}
 
 				displaced := false
 				resetPlacements64 := make([]uint64, opts.Datashard+opts.Parityshard)
@@ -216,6 +308,13 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 						add = true
 					}
 
+					if chk == nil && placements == nil {
+						// Never cached, e.g. written around.
+						chk = &proxy.Chunk{
+							Key: fmt.Sprintf("%d@%s", i, obj.Key),
+							Sz:  obj.ChunkSz,
+						}
+					}
 					if chk == nil {
 						// Unlikely, but just in case
 						log.Warn("Failed to track chunk %d@%s on resetting", i, obj.Key)
@@ -230,17 +329,29 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 				if displaced {
 					p.ResetPlacements(obj.Key, resetPlacements)
 				}
+			} else if placements == nil {
+				// Release requests waiting for placements.
+				p.ClearPlacements(obj.Key)
 			}
-			return "get", reqId, PerformResultNotFound
+			return "get", reqId, PerformResultNotFound, provider
 		} else if reader != nil {
-			reader.Close()
+			if nearCacheOptions != nil && err == nil {
+				// Cached after the hit is validated.
+				reader, err = nearCacheOptions.Admit(obj.Key, reader)
+			}
+			if verifier != nil && reader != nil {
+				verifier.Verify(reqId, obj.Key, int(obj.Size), reader)
+			}
+			if reader != nil {
+				reader.Close()
+			}
 		}
 		if err != nil {
-			return "get", reqId, PerformResultError
+			return "get", reqId, PerformResultError, tieredStats.Cache.Name
 		}
 
 		atomic.AddInt32(&keyGets, 1)
-		log.Trace("Get %s.", obj.Key)
+		logSampling.Logger(LogPerform).Trace("Get %s.", obj.Key)
 
 		for i, idx := range placements {
 			chk, ok := p.LambdaPool[idx].GetChunk(fmt.Sprintf("%d@%s", i, obj.Key))
@@ -251,31 +362,56 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 			chk.Freq++
 			p.LambdaPool[idx].Activate(obj.Timestamp)
 		}
-		return "get", reqId, PerformResultSuccess
+		return "get", reqId, PerformResultSuccess, tieredStats.Cache.Name
 	} else {
-		log.Trace("No placements found: %v", obj.Key)
+		logSampling.Logger(LogPerform).Trace("No placements found: %v", obj.Key)
 
 		// if key does not exist, generate the index array holding
 		// indexes of the destination lambdas
-		var val []byte
-		if !opts.Lean {
-			val = make([]byte, obj.Size)
-			rand.Read(val)
-		}
 		placements32 := make([]int, opts.Datashard+opts.Parityshard)
 		placements := make([]uint64, len(placements32))
-		if len(clientPools) > 1 {
-			go func(key string, val []byte) {
-				cli := clientPools[1].Get().(benchclient.Client)
-				cli.EcSet(key, val, dryrun)
-				clientPools[1].Put(cli)
-			}(obj.Key, val)
+		var payload *benchclient.Payload
+		if !opts.Lean {
+			payload = newPayload(obj)
 		}
 		atomic.AddInt32(&sets, 1)
-		reqId, err := cli.EcSet(obj.Key, val, dryrun, placements32, "Normal")
+		if tier.HasOrigin() && tier.Policy() != benchclient.WriteBack {
+			// Write the same version to the origin first.
+			var origin client.ReadAllCloser
+			if payload != nil {
+				origin = payload.Clone()
+			}
+			originStart := time.Now()
+			reqId, err := tier.SetOrigin(obj.Key, origin, false, dryrun)
+			latencies.Since(LatencyOpSet, tieredStats.Origin.Name, err, obj.Size, originStart)
+			spans.Since(LatencyOpSet, tieredStats.Origin.Name, err, originStart)
+			if err != nil {
+				log.Warn("Failed to write %s to the origin: %v", obj.Key, err)
+				p.ClearPlacements(obj.Key)
+				return "set", reqId, PerformResultError, tieredStats.Origin.Name
+			} else if tier.Policy() == benchclient.WriteAround {
+				if verifier != nil {
+					verifier.Commit(payload)
+				}
+				// Not cached until repaired.
+				p.ClearPlacements(obj.Key)
+				return "set", reqId, PerformResultSuccess, tieredStats.Origin.Name
+			}
+		}
+		setStart := time.Now()
+		reqId, err := tier.SetCache(obj.Key, payloadReader(payload), dryrun, placements32, "Normal")
+		latencies.Since(LatencyOpSet, tieredStats.Cache.Name, err, obj.Size, setStart)
+		spans.Since(LatencyOpSet, tieredStats.Cache.Name, err, setStart)
 		if err != nil {
 			p.ClearPlacements(obj.Key)
-			return "set", reqId, PerformResultError
+			return "set", reqId, PerformResultError, tieredStats.Cache.Name
+		}
+		if verifier != nil {
+			verifier.Commit(payload)
+		}
+		if tier.Policy() == benchclient.WriteBack {
+			// The same version is written back to the origin.
+			tier.SetOrigin(obj.Key, payloadReader(payload), true, dryrun)
 		}
 		for i := 0; i < len(placements32); i++ {
 			placements[i] = uint64(placements32[i])
@@ -299,11 +435,19 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 			}
 			p.LambdaPool[idx].Activate(obj.Timestamp)
 		}
-		log.Trace("Set %s, placements: %v.", obj.Key, placements)
+		logSampling.Logger(LogPerform).Trace("Set %s, placements: %v.", obj.Key, placements)
 		p.SetPlacements(obj.Key, placements)
 		atomic.AddInt32(&keySets, 1)
-		return "set", reqId, PerformResultSuccess
+		return "set", reqId, PerformResultSuccess, tieredStats.Cache.Name
+	}
+}
+
+// newPayload returns the payload of the object. A new version is derived for each write in verify mode.
+func newPayload(obj *proxy.Object) *benchclient.Payload {
+	if verifier != nil {
+		return verifier.NextPayload(obj.Key, int(obj.Size))
 	}
+	return benchclient.NewPayload(obj.Key, int(obj.Size))
 }
 
 func initProxies(nProxies int, opts *Options) ([]*proxy.Proxy, *consistent.Consistent) {
@@ -336,11 +480,23 @@ func initProxies(nProxies int, opts *Options) ([]*proxy.Proxy, *consistent.Consi
 
 func helpInfo(flag *sysflag.FlagSet) {
 	fmt.Fprintf(os.Stderr, "Usage: ./playback [options] tracefile\n")
+	fmt.Fprintf(os.Stderr, "       ./playback %s [options] file.clog [file.clog ...]\n", DecodeCommand)
+	fmt.Fprintf(os.Stderr, "       ./playback %s [options] file_report.json [file_report.json ...]\n", ReportCommand)
+	fmt.Fprintf(os.Stderr, "       ./playback %s [options] base_report.json file_report.json [file_report.json ...]\n", CompareCommand)
 	fmt.Fprintf(os.Stderr, "Available options:\n")
 	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "Available services:\n%s\n", benchclient.ProviderUsage())
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == DecodeCommand {
+		os.Exit(decodeMain(os.Args[2:]))
+	} else if len(os.Args) > 1 && os.Args[1] == ReportCommand {
+		os.Exit(htmlReportMain(os.Args[2:]))
+	} else if len(os.Args) > 1 && os.Args[1] == CompareCommand {
+		os.Exit(compareMain(os.Args[2:]))
+	}
+
 	flag := sysflag.NewFlagSet("defaut", sysflag.ContinueOnError)
 
 	var printInfo bool
@@ -355,9 +511,11 @@ func main() {
 	flag.IntVar(&options.Datashard, "d", 10, "number of data shards for RS erasure coding")
 	flag.IntVar(&options.Parityshard, "p", 2, "number of parity shards for RS erasure coding")
 	flag.IntVar(&options.ECmaxgoroutine, "g", 32, "max number of goroutines for RS erasure coding")
+	flag.BoolVar(&options.ErasureCode, "ec", false, "erasure code objects on s3, redis and dummy services using the settings of -d, -p and -g, as SION does.")
+	flag.IntVar(&options.ErasureBackends, "ecBackends", 1, "number of client instances of the service that shards are spread over. Shards are always stored in distinct keys.")
 	flag.BoolVar(&options.NoDebug, "disable-debug", false, "disable printing debugging log?")
 	flag.BoolVar(&options.SummaryOnly, "summary-only", false, "show summary only")
-	flag.StringVar(&options.File, "file", "", "print result to file")
+	flag.StringVar(&options.File, "file", "", "print result to file: logs to <file>_playback.clog and the report to <file>_report.json")
 	flag.BoolVar(&options.Dryrun, "dryrun", false, "no actual invocation, with -lean and -compact set to true by default.")
 	// flag.BoolVar(&options.Lean, "lean", false, "run with minimum memory consumtion, valid only if dryrun=true")
 	// flag.BoolVar(&options.Compact, "compact", false, "playback in compact mode")
@@ -367,11 +525,18 @@ func main() {
 	flag.Int64Var(&options.Limit, "limit", 0, "limit to play N records only")
 	flag.Int64Var(&options.LimitHour, "limitHour", 0, "limit to play N hours only")
 	flag.Int64Var(&options.Skip, "skip", 0, "skip N records")
-	flag.StringVar(&options.S3, "s3", "", "s3 bucket for enable s3 simulation")
-	flag.StringVar(&options.Redis, "redis", "", "Redis address for enable Redis simulation")
-	flag.IntVar(&options.RedisCluster, "redisCluster", 1, "The number of nodes in the redis cluster. Set larger than 1 to enable Redis cluster")
-	flag.BoolVar(&options.Dummy, "dummy", false, "using Dummy client for simulation")
-	flag.StringVar(&options.Failover, "failover", "", "specify the failover service in case the main service failed. The failover service can be s3 and must be enabled in parameters.")
+	flag.StringVar(&options.Faults, "faults", "", "inject faults to the main service, following the rules in the file or rules separated by ';'. e.g. \"error op=get p=0.01;latency prefix=abc from=10m to=20m delay=2s\". Kinds: error, notfound, timeout, latency, truncate.")
+	flag.StringVar(&options.FailoverFaults, "failoverFaults", "", "inject faults to the failover service, see -faults.")
+	flag.IntVar(&options.Retry.Attempts, "retry", 0, "max attempts of requests to the main service, including the first one. Retry is disabled if not larger than 1")
+	flag.DurationVar(&options.Retry.Backoff, "backoff", benchclient.DefaultRetryBackoff, "initial backoff before retrying, doubled for each retry")
+	flag.DurationVar(&options.Retry.MaxBackoff, "maxBackoff", benchclient.DefaultRetryMaxBackoff, "max backoff before retrying")
+	flag.StringVar(&options.Hedge, "hedge", "", "send a hedged get to the main service if not responded after the delay, can be a duration like 100ms or a percentile of latencies observed like p95")
+	flag.Int64Var(&options.NearCache, "nearCache", 0, "capacity in bytes of the near cache of objects read in the process, in front of the main service. Only sizes are stored with -lean, and nothing is cached with -dryrun. 0 to disable")
+	flag.StringVar(&options.Provider, "provider", "", "specify the main service. Default to the only service enabled in parameters, or default (SION) if none.")
+	flag.StringVar(&options.Failover, "failover", "", "specify the failover service in case the main service failed. The failover service must be enabled in parameters.")
+	flag.StringVar(&options.Mirror, "mirror", "", "mirror requests to the main service to the specified service, e.g. -mirror redis with the main service default. The service must be enabled in parameters.")
+	flag.StringVar(&options.WritePolicy, "writePolicy", benchclient.WriteBack, "write policy of the main service as the cache of the failover service: through, around or back.")
+	flag.BoolVar(&options.ReadRepair, "readRepair", true, "refill the main service on a miss.")
 	flag.BoolVar(&options.Balance, "balance", false, "enable balancer on dryrun")
 	flag.IntVar(&options.Concurrency, "c", 100, "max concurrency allowed, minimum 1.")
 	flag.Int64Var(&options.Bandwidth, "w", 0, "unit bandwidth per shard in MiB/s. 0 for unlimited bandwidth")
@@ -380,6 +545,19 @@ func main() {
 	flag.Uint64Var(&options.SampleKey, "sk", 0, "the key of sample")
 	flag.Uint64Var(&options.FunctionCapacity, "fc", 0, "specify the capacity of functions")
 	flag.Uint64Var(&options.FunctionOverhead, "fo", 0, "specify the overhead of functions")
+	benchclient.RegisterProviderFlags(flag)
+	flag.BoolVar(&options.Verify, "verify", false, "verify the integrity of objects read, not available with -dryrun or -lean.")
+	flag.DurationVar(&options.Interval, "interval", 0, "report throughput, hit ratio, concurrency, lag and latencies of requests completed in every interval, e.g. 1m. 0 to disable.")
+	flag.StringVar(&options.IntervalClock, "intervalClock", IntervalClockWall, "clock of intervals: wall, or trace to follow the time in the trace.")
+	flag.StringVar(&options.IntervalFile, "intervalFile", "", "write intervals to the CSV file, default to <file>_intervals.csv if -file is specified.")
+	flag.StringVar(&options.Metrics, "metrics", "", "serve Prometheus metrics at the address, e.g. :9100, on path /metrics.")
+	flag.StringVar(&options.Latencies, "latencies", "", "save latency histograms to the JSON file, which can be merged with ones of repeated runs by compare -latencies.")
+	flag.StringVar(&options.LogSample, "logSample", "", "sample frequent logs by category: schedule, dispatch, perform or all, e.g. \"perform=100,dispatch=10/s,schedule=off\" to log 1 in 100 lines of perform and at most 10 lines per second of dispatch. Warnings and errors are always logged.")
+	flag.StringVar(&options.LogFile, "logFile", "", "write logs to the file as structured lines without color instead of the terminal. Warnings and errors are still shown.")
+	flag.StringVar(&options.Spans, "spans", "", "export spans of pool waits and operations on services of requests to the file in the OTLP-JSON format.")
+	flag.Float64Var(&options.SpanRate, "spanRate", 1, "fraction of requests of which spans are exported, 0 to export slow requests only.")
+	flag.DurationVar(&options.SpanSlow, "spanSlow", 0, "always export spans of requests not faster than the threshold, e.g. 1s. 0 to disable.")
+	flag.StringVar(&options.Results, "results", "", "write the result, timing and scheduling lag of each request to the CSV file.")
 
 	flag.Parse(os.Args[1:])
 
@@ -402,12 +580,30 @@ func main() {
 	}
 
 	if options.NoDebug {
-		log.Verbose = false
-		log.Level = logger.LOG_LEVEL_INFO
+		colorLog.Verbose = false
+		colorLog.Level = logger.LOG_LEVEL_INFO
 	}
 	if options.SummaryOnly {
-		log.Verbose = false
-		log.Level = logger.LOG_LEVEL_WARN
+		colorLog.Verbose = false
+		colorLog.Level = logger.LOG_LEVEL_WARN
+	}
+	var fileLogger *FileLogger
+	if options.LogFile != "" {
+		var err error
+		if fileLogger, err = NewFileLogger(options.LogFile, colorLog.Level, colorLog.Verbose); err != nil {
+			log.Error("Failed to create log file: %v", err)
+			os.Exit(1)
+		}
+		// Warnings and errors are still shown.
+		fileLogger.Echo = colorLog
+		log = fileLogger
+		global.Log = log
+	}
+	if sampling, err := NewLogSampling(options.LogSample, log); err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	} else {
+		logSampling = sampling
 	}
 	if options.Concurrency <= 0 {
 		options.Concurrency = 1
@@ -419,6 +615,38 @@ func main() {
 	if options.FunctionOverhead > 0 {
 		proxy.FunctionOverhead = options.FunctionOverhead
 	}
+	if options.Verify {
+		if options.Lean {
+			log.Error("Verification requires objects generated, remove -dryrun and -lean.")
+			os.Exit(1)
+		}
+		verifier = NewVerifier()
+		benchclient.ChecksumReads = true
+	}
+	if options.ErasureCode {
+		if options.ErasureBackends < 1 {
+			options.ErasureBackends = 1
+		}
+		if err := benchclient.ValidateErasureOptions(ErasureOptions(options)); err != nil {
+			log.Error("Invalid erasure coding settings of -d %d -p %d: %v", options.Datashard, options.Parityshard, err)
+			os.Exit(1)
+		}
+	}
+	if clock, err := ValidateIntervalClock(strings.ToLower(options.IntervalClock)); err != nil {
+		log.Error("%v: %s", err, options.IntervalClock)
+		os.Exit(1)
+	} else {
+		options.IntervalClock = clock
+	}
+	if options.Interval > 0 && options.IntervalFile == "" && options.File != "" {
+		options.IntervalFile = options.File + "_intervals.csv"
+	}
+	if policy, err := benchclient.ValidateWritePolicy(strings.ToLower(options.WritePolicy)); err != nil {
+		log.Error("%v: %s", err, options.WritePolicy)
+		os.Exit(1)
+	} else {
+		options.WritePolicy = policy
+	}
 
 	traceFile, err := os.Open(flag.Arg(0))
 	if err != nil {
@@ -427,22 +655,33 @@ func main() {
 	}
 	finalizeOptions.traceFile = traceFile
 
-	nanologProvider := benchclient.SetLogger
+	var nanologProvider NanoLogProvider = benchclient.SetLogger
 	addrArr := strings.Split(options.AddrList, ",")
 	proxies, ring := initProxies(len(addrArr), options)
-	if options.Dummy {
-		benchclient.ResetDummySizeRegistry()
+	faultScripts := make([]*benchclient.FaultScript, 2)
+	for i, spec := range []string{options.Faults, options.FailoverFaults} {
+		if spec == "" {
+			continue
+		}
+		script, err := benchclient.NewFaultScript(spec)
+		if err != nil {
+			log.Error("Failed to load fault rules: %v", err)
+			os.Exit(1)
+		}
+		faultScripts[i] = script
 	}
-	clientProviders := BuildClientProviders(options)
 	clientPools = make([]*proxy.Pool, 1, 2)
 	// Initiate failover client pool
 	if options.Failover != "" {
-		provider, ok := clientProviders[strings.ToLower(options.Failover)]
-		if !ok {
-			log.Error("Failover client specified but not enabled: %s", strings.ToLower(options.Failover))
+		provider, err := NewClientProvider(options.Failover, benchclient.ProviderRoleFailover, options)
+		if err != nil {
+			log.Error("Invalid failover service: %v", err)
 			os.Exit(1)
 			return
 		}
+		if faultScripts[1] != nil {
+			provider = ChainClientProvider(provider, benchclient.FaultMiddleware(faultScripts[1]))
+		}
 		clientPools = append(clientPools, proxy.InitPool(&proxy.Pool{
 			New: func() interface{} {
 				// Only count the main pool.
@@ -453,32 +692,124 @@ func main() {
 				c.(benchclient.Client).Close()
 			},
 		}, options.Concurrency, proxy.PoolForStrictConcurrency))
-		delete(clientProviders, strings.ToLower(options.Failover))
-
-		if options.Failover == ProviderDummy {
-			clientProviders[ProviderDummy] = GenDummyClientProvider(options.Bandwidth, benchclient.DummyCache)
-		}
 	}
-	// Ensure main client pool exists.
-	if len(clientProviders) == 0 {
-		clientProviders[ProviderDefault] = GenDefaultClientProvider(options)
+	// Initiate mirror client pool
+	var mirrorPool *proxy.Pool
+	if options.Mirror != "" {
+		provider, err := NewClientProvider(options.Mirror, benchclient.ProviderRoleMirror, options)
+		if err != nil {
+			log.Error("Invalid mirror service: %v", err)
+			os.Exit(1)
+			return
+		}
+		mirrorPool = proxy.InitPool(&proxy.Pool{
+			New: func() interface{} {
+				return provider()
+			},
+			Finalize: func(c interface{}) {
+				c.(benchclient.Client).Close()
+			},
+		}, options.Concurrency, proxy.PoolForStrictConcurrency)
 	}
 	// Initiate main client pool
-	for key, provider := range clientProviders {
-		clientPools[0] = proxy.InitPool(&proxy.Pool{
+	mainProvider := SelectMainProvider(options)
+	if verifier != nil && mainProvider == benchclient.ProviderDummy {
+		log.Error("Verification requires objects stored, but Dummy clients keep sizes only. Remove -verify or -dummy.")
+		os.Exit(1)
+	}
+	provider, err := NewClientProvider(mainProvider, benchclient.ProviderRoleMain, options)
+	if err != nil {
+		log.Error("Invalid main service: %v", err)
+		os.Exit(1)
+	}
+	middlewareStats := benchclient.NewMiddlewareStats()
+	var mirrorStats *benchclient.MirrorStats
+	var hedgePool *proxy.Pool
+	var middlewares []benchclient.Middleware
+	if faultScripts[0] != nil {
+		middlewares = append(middlewares, benchclient.FaultMiddleware(faultScripts[0]))
+	}
+	if options.Retry.Attempts > 1 {
+		middlewares = append(middlewares, benchclient.RetryMiddleware(options.Retry, middlewareStats))
+	}
+	if options.Hedge != "" {
+		hedgeOpts, err := ParseHedgeOptions(options.Hedge)
+		if err != nil {
+			log.Error("Invalid hedging option: %v", err)
+			os.Exit(1)
+		}
+		// Hedged gets are sent using clients from a dedicated pool to avoid deadlocks.
+		hedgeProvider := ChainClientProvider(provider, middlewares...)
+		hedgePool = proxy.InitPool(&proxy.Pool{
 			New: func() interface{} {
-				atomic.AddInt32(&numClients, 1)
-				return provider()
+				return hedgeProvider()
 			},
 			Finalize: func(c interface{}) {
 				c.(benchclient.Client).Close()
 			},
 		}, options.Concurrency, proxy.PoolForStrictConcurrency)
-		if key == ProviderDefault {
-			nanologProvider = client.SetLogger
+		hedgeOpts.Acquire = func() benchclient.Client {
+			return hedgePool.Get().(benchclient.Client)
+		}
+		hedgeOpts.Release = func(cli benchclient.Client) {
+			hedgePool.Put(cli)
 		}
-		break
+		middlewares = append(middlewares, benchclient.HedgeMiddleware(hedgeOpts, middlewareStats))
 	}
+	if mirrorPool != nil {
+		mirrorStats = benchclient.NewMirrorStats(mainProvider, strings.ToLower(options.Mirror))
+		middlewares = append(middlewares, benchclient.MirrorMiddleware(benchclient.MirrorOptions{
+			Acquire: func() benchclient.Client {
+				return mirrorPool.Get().(benchclient.Client)
+			},
+			Release: func(cli benchclient.Client) {
+				mirrorPool.Put(cli)
+			},
+		}, mirrorStats))
+	}
+	if options.NearCache > 0 {
+		nearCacheStats = &benchclient.NearCacheStats{Cache: benchclient.NewLRU(options.NearCache)}
+		nearCacheOptions = &benchclient.NearCacheOptions{
+			Cache:     nearCacheStats.Cache,
+			SizesOnly: options.Lean,
+		}
+		middlewares = append(middlewares, benchclient.NearCacheMiddleware(*nearCacheOptions, nearCacheStats))
+	}
+	provider = ChainClientProvider(provider, middlewares...)
+	clientPools[0] = proxy.InitPool(&proxy.Pool{
+		New: func() interface{} {
+			atomic.AddInt32(&numClients, 1)
+			return provider()
+		},
+		Finalize: func(c interface{}) {
+			c.(benchclient.Client).Close()
+		},
+	}, options.Concurrency, proxy.PoolForStrictConcurrency)
+	if mainProvider == ProviderDefault {
+		nanologProvider = client.SetLogger
+		if faultScripts[0] != nil || faultScripts[1] != nil || mirrorPool != nil {
+			// Log faults injected and mirrored requests.
+			nanologProvider = nanologProvider.And(benchclient.SetLogger)
+		}
+	}
+
+	// Initiate tiers
+	tieredOptions = benchclient.TieredOptions{
+		Policy:     options.WritePolicy,
+		ReadRepair: options.ReadRepair,
+		WriteBackFailed: func(key string, err error) {
+			log.Warn("Failed to write back %s to the failover: %v", key, err)
+		},
+	}
+	if len(clientPools) > 1 {
+		tieredOptions.Acquire = func() benchclient.Client {
+			return clientPools[1].Get().(benchclient.Client)
+		}
+		tieredOptions.Release = func(cli benchclient.Client) {
+			clientPools[1].Put(cli)
+		}
+	}
+	tieredStats = benchclient.NewTieredStats(mainProvider, strings.ToLower(options.Failover))
 
 	if options.File != "" {
 		if err := logCreate(options, nanologProvider); err != nil {
@@ -487,6 +818,28 @@ func main() {
 		finalizeOptions.closeNanolog = true
 	}
 
+	var resultWriter *ResultWriter
+	if options.Results != "" {
+		resultWriter, err = NewResultWriter(options.Results)
+		if err != nil {
+			log.Error("Failed to create results file: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	var spanExporter *SpanExporter
+	if options.Spans != "" {
+		spanExporter, err = NewSpanExporter(SpanExporterOptions{
+			File: options.Spans,
+			Rate: options.SpanRate,
+			Slow: options.SpanSlow,
+		})
+		if err != nil {
+			log.Error("Failed to create spans file: %v", err)
+			os.Exit(1)
+		}
+	}
+
 	var reader readers.RecordReader
 	switch strings.ToLower(options.TraceName) {
 	case "ibmobjectstore":
@@ -499,6 +852,7 @@ func main() {
 
 	timer := time.NewTimer(0)
 	requestsCleared := make(chan time.Time, 1) // To be notified that all invoked requests were responded.
+	var dispatched sync.WaitGroup              // Requests dispatched and not finished, including recording results.
 	read := int64(0)
 	var skippedDuration time.Duration
 	var firstTs int64
@@ -519,8 +873,59 @@ func main() {
 		skipper = helpers.NewTimeSkipper(options.Concurrency)
 	}
 
+	var intervalStats *IntervalStats
+	if options.Interval > 0 {
+		intervalStats, err = NewIntervalStats(IntervalOptions{
+			Period: options.Interval,
+			Clock:  options.IntervalClock,
+			Stdout: os.Stdout,
+			File:   options.IntervalFile,
+			Concurrency: func() int32 {
+				return atomic.LoadInt32(&concurrency)
+			},
+		})
+		if err != nil {
+			log.Error("Failed to create intervals file: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	var metrics *Metrics
+	if options.Metrics != "" {
+		pools := map[string]*proxy.Pool{"main": clientPools[0]}
+		if len(clientPools) > 1 {
+			pools["failover"] = clientPools[1]
+		}
+		if mirrorPool != nil {
+			pools["mirror"] = mirrorPool
+		}
+		if hedgePool != nil {
+			pools["hedge"] = hedgePool
+		}
+		metrics = NewMetrics(MetricsOptions{
+			Concurrency: func() int32 {
+				return atomic.LoadInt32(&concurrency)
+			},
+			Pools:   pools,
+			Proxies: proxies,
+		})
+		if err := metrics.Listen(options.Metrics); err != nil {
+			log.Error("Failed to serve metrics: %v", err)
+			os.Exit(1)
+		}
+		log.Info("Serving metrics at %s%s", metrics.Addr(), MetricsPath)
+	}
+
 	// Start replaying.
 	start := time.Now()
+	if intervalStats != nil {
+		intervalStats.Start(start)
+	}
+	for _, script := range faultScripts {
+		if script != nil {
+			script.Start(start)
+		}
+	}
 	stop := int64(0)
 	if options.Limit > 0 {
 		stop = options.Skip + options.Limit
@@ -550,7 +955,7 @@ func main() {
 			continue
 		} else if rec.Error == readers.ErrIgnoreIBMObjectStoreFragment {
 			reader.Done(rec)
-			log.Debug("Skip %d: %v", read, rec.Error)
+			logSampling.Logger(LogSchedule).Debug("Skip %d: %v", read, rec.Error)
 			continue
 		} else if rec.Error != nil {
 			reader.Done(rec)
@@ -558,7 +963,7 @@ func main() {
 			continue
 		} else if rec.Method != "" && rec.Method != "GET" && rec.Method != "PUT" {
 			reader.Done(rec)
-			log.Debug("Skip %d: unsupported method %v", read, rec.Method)
+			logSampling.Logger(LogSchedule).Debug("Skip %d: unsupported method %v", read, rec.Method)
 			continue
 		} else if options.SampleFractions > 1 && (xxhash.Sum64([]byte(rec.Key))%options.SampleFractions) != options.SampleKey {
 			// Sampleing
@@ -604,13 +1009,13 @@ func main() {
 			if read <= options.Skip {
 				skippedDuration += timeToStart
 				if timeToStart > 0 {
-					log.Info("Skip %d: %v", read, timeToStart)
+					logSampling.Logger(LogSchedule).Info("Skip %d: %v", read, timeToStart)
 				}
 			} else {
 				if timeToStart > 0 {
 					timer.Reset(timeToStart)
 					planned = planned.Add(timeToStart)
-					log.Info("Playback %d in %v", read, timeToStart)
+					logSampling.Logger(LogSchedule).Info("Playback %d in %v", read, timeToStart)
 				}
 			}
 		}
@@ -625,6 +1030,9 @@ func main() {
 				log.Info("Time limit(%v) reached.", stopAt)
 				break
 			}
+			if intervalStats != nil {
+				intervalStats.Advance(time.Duration(obj.Timestamp - firstTs))
+			}
 
 			now := time.Now()
 			if timeToStart > 0 {
@@ -632,7 +1040,7 @@ func main() {
 					// Use skipper in dryrun and compact mode.
 					skipper.SkipTo(planned)
 					skippedDuration += planned.Sub(now) // Update total duration skipped.
-					log.Info("Simulating skipped and forwarded %v in compact mode", timeToStart)
+					logSampling.Logger(LogSchedule).Info("Simulating skipped and forwarded %v in compact mode", timeToStart)
 				} else if !options.Compact {
 					// In normal mode, wait for the next request.
 					now = <-timer.C
@@ -646,7 +1054,7 @@ func main() {
 						}
 						skippedDuration += skipped // Update total duration skipped.
 						now = clearedAt
-						log.Info("Forwarded %v in compact mode", skipped)
+						logSampling.Logger(LogSchedule).Info("Forwarded %v in compact mode", skipped)
 						// No need to stop timer. It is stopped on processing each object.
 					case now = <-timer.C:
 						// Do nothing
@@ -663,15 +1071,27 @@ func main() {
 			// for options.Concurrency > 0 && atomic.LoadInt32(&concurrency) >= int32(options.Concurrency) {
 			// 	cond.Wait()
 			// }
+			waitStart := time.Now()
 			cli := clientPools[0].Get().(benchclient.Client)
+			poolWait := time.Since(waitStart)
+			var spans *RequestSpans
+			if spanExporter != nil {
+				spans = NewRequestSpans(waitStart,
+					SpanAttribute{Key: "seq", Value: read},
+					SpanAttribute{Key: "key", Value: obj.Key},
+					SpanAttribute{Key: "size", Value: obj.Size})
+				spans.Add(SpanPoolWait, "", nil, waitStart, waitStart.Add(poolWait))
+			}
 
 			// Start perform
 			var notifier *helpers.TimeSkipNotification
 			if skipper != nil {
-				log.Debug("Mark to skip %v for simulating processing %d:%s", obj.Estimation, read, obj.Key)
+				logSampling.Logger(LogSchedule).Debug("Mark to skip %v for simulating processing %d:%s", obj.Estimation, read, obj.Key)
 				notifier = skipper.MarkDuration(read, obj.Estimation)
 			}
-			go func(sn int64, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object, expected time.Duration, scheduled time.Duration, notifier *helpers.TimeSkipNotification) {
+			dispatched.Add(1)
+			go func(sn int64, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object, expected time.Duration, scheduled time.Duration, poolWait time.Duration, spans *RequestSpans, notifier *helpers.TimeSkipNotification) {
+				defer dispatched.Done()
 				// defer func() {
 				// 	finalize(finalizeOptions)
 				// 	// if err := recover(); err != nil {
@@ -687,15 +1107,49 @@ func main() {
 				}
 
 				actural := skippedDuration + time.Since(start)
-				log.Info("%d(c:%d) Playbacking %v %s (expc %v, schd %v, actc %v)...", sn, c, obj.Key, humanize.Bytes(obj.Size), expected, scheduled, actural)
-
-				_, reqId, _ := perform(options, cli, p, obj)
+				logSampling.Logger(LogDispatch).Info("%d(c:%d) Playbacking %v %s (expc %v, schd %v, actc %v)...", sn, c, obj.Key, humanize.Bytes(obj.Size), expected, scheduled, actural)
+
+				performStart := time.Now()
+				op, reqId, ret, provider := perform(options, cli, p, obj, spans)
+				latency := time.Since(performStart)
+				spans.Finish(op, ret, performStart.Add(latency),
+					SpanAttribute{Key: "provider", Value: provider},
+					SpanAttribute{Key: "reqId", Value: reqId})
 				clientPools[0].Put(cli)
 				if notifier != nil {
 					notifier.Wait()
 					// log.Debug("Skipped %d:%s", sn, obj.Key)
 				}
 
+				logSampling.Logger(LogDispatch).Debug("csv,%s,%s,%d,%d,%d", reqId, obj.Key, expected, actural, obj.Size)
+				result := &Result{
+					Seq:        sn,
+					Key:        obj.Key,
+					Op:         op,
+					Result:     ret,
+					Size:       obj.Size,
+					Scheduled:  expected,
+					Dispatched: actural,
+					Latency:    latency,
+					PoolWait:   poolWait,
+					Provider:   provider,
+					ReqId:      reqId,
+				}
+				if intervalStats != nil {
+					intervalStats.Record(result)
+				}
+				if metrics != nil {
+					metrics.Record(result)
+				}
+				if resultWriter != nil {
+					resultWriter.Write(result)
+				}
+				if spanExporter != nil {
+					spanExporter.Export(spans)
+				}
+				reader.Done(obj.Record)
+				obj.Record = nil
+
 				// Requests cleared
 				if atomic.AddInt32(&concurrency, -1) == 0 {
 					select {
@@ -706,11 +1160,8 @@ func main() {
 						requestsCleared <- time.Now()
 					}
 				}
-				log.Debug("csv,%s,%s,%d,%d,%d", reqId, obj.Key, expected, actural, obj.Size)
-				reader.Done(obj.Record)
-				obj.Record = nil
 				// cond.Signal()
-			}(read, cli, proxies[id], obj, time.Duration(obj.Timestamp-firstTs), skippedDuration+now.Sub(start), notifier)
+			}(read, cli, proxies[id], obj, time.Duration(obj.Timestamp-firstTs), skippedDuration+now.Sub(start), poolWait, spans, notifier)
 
 			// cond.L.Unlock()
 		}
@@ -720,60 +1171,124 @@ func main() {
 	if skipper != nil {
 		skippedDuration += skipper.SkipAll()
 	}
-	<-requestsCleared
-
-	totalMem := float64(0)
-	maxMem := float64(0)
-	minMem := float64(10000000000000)
-	maxChunks := float64(0)
-	minChunks := float64(1000)
-	setChunks := 0
-	gotChunks := uint64(0)
-	resetChunks := uint64(0)
-	activated := 0
-	var balancerCost time.Duration
+	// Writers and the span exporter are closed after all results and spans are recorded.
+	dispatched.Wait()
+	tieredStats.Wait()
+	if intervalStats != nil {
+		if err := intervalStats.Close(time.Since(start)); err != nil {
+			log.Warn("Failed to write intervals: %v", err)
+		}
+	}
+	if resultWriter != nil {
+		if err := resultWriter.Close(); err != nil {
+			log.Warn("Failed to write results: %v", err)
+		}
+	}
+	if spanExporter != nil {
+		if err := spanExporter.Close(); err != nil {
+			log.Warn("Failed to export spans: %v", err)
+		}
+	}
+
+	report := NewReport(options, flag.Arg(0), start)
+	report.Elapsed = time.Since(start)
+	flag.VisitAll(func(f *sysflag.Flag) {
+		report.Flags[f.Name] = f.Value.String()
+	})
+	report.Provider = mainProvider
+	report.Records = read - options.Skip
 	for i := 0; i < len(proxies); i++ {
-		prxy := proxies[i]
-		for j := 0; j < len(prxy.LambdaPool); j++ {
-			lambda := prxy.LambdaPool[j]
-			totalMem += float64(lambda.MemUsed)
-			minMem = math.Min(minMem, float64(lambda.MemUsed))
-			maxMem = math.Max(maxMem, float64(lambda.MemUsed))
-			minChunks = math.Min(minChunks, float64(lambda.NumChunks()))
-			maxChunks = math.Max(maxChunks, float64(lambda.NumChunks()))
-			setChunks += lambda.NumChunks()
-			for chk := range lambda.AllChunks() {
-				gotChunks += chk.Value.(*proxy.Chunk).Freq
-				resetChunks += chk.Value.(*proxy.Chunk).Reset
+		report.AddProxy(proxies[i])
+		proxies[i].Close()
+	}
+	report.Sets = ReportSets{Total: sets, Succeeded: keySets}
+	report.Gets = ReportGets{Total: gets, Succeeded: keyGets, Missed: keyMiss, NearCacheHits: keyNearCacheHits}
+	for i, pool := range []string{"main", "failover"} {
+		if faultScripts[i] != nil {
+			if report.Faults == nil {
+				report.Faults = make(map[string]string)
 			}
-			activated += lambda.ActiveMinutes
-		}
-		setChunks += prxy.NumEvicts()
-		for chk := range prxy.AllEvicts() {
-			gotChunks += chk.Value.(*proxy.Chunk).Freq
-			resetChunks += chk.Value.(*proxy.Chunk).Reset
-		}
-		balancerCost += prxy.BalancerCost
-		prxy.Close()
-	}
-	syslog.Printf("Time elpased: %v\n", time.Since(start))
-	syslog.Printf("Total records: %d\n", read-options.Skip)
-	syslog.Printf("Total memory consumed: %s\n", humanize.Bytes(uint64(totalMem)))
-	syslog.Printf("Memory consumed per lambda: %s - %s\n", humanize.Bytes(uint64(minMem)), humanize.Bytes(uint64(maxMem)))
-	syslog.Printf("Chunks per lambda: %d - %d\n", int(minChunks), int(maxChunks))
-	syslog.Printf("Chunks set %d, got %d, reset %d, hit ratio %d%%\n", setChunks, gotChunks, resetChunks, gotChunks*100/(gotChunks+resetChunks))
-	syslog.Printf("Puts total %d, succeeded %d\n", sets, keySets)
-	syslog.Printf("Gets total %d, succeeded %d, miss %d, hit ratio %d%%\n", gets, keyGets, keyMiss, keyGets*100/gets)
-	syslog.Printf("Active Minutes %d\n", activated)
-	syslog.Printf("BalancerCost: %s(%s per request)", balancerCost, balancerCost/time.Duration(read-options.Skip))
-	syslog.Printf("Max concurrency: %d, clients initialized: %d\n", maxConcurrency, atomic.LoadInt32(&numClients))
-	for _, msg := range reader.Report() {
-		syslog.Println(msg)
+			report.Faults[pool] = faultScripts[i].String()
+		}
+	}
+	if options.Retry.Attempts > 1 || options.Hedge != "" {
+		report.Middlewares = middlewareStats
+	}
+	if mirrorStats != nil {
+		mirrorStats.Wait()
+		report.Mirror = &ReportText{
+			Title: fmt.Sprintf("Mirror (%s vs %s)", mirrorStats.Primary, mirrorStats.Shadow),
+			Lines: strings.Split(mirrorStats.String(), "\n"),
+		}
+	}
+	if nearCacheStats != nil {
+		stats := nearCacheStats.Cache.Stats()
+		report.NearCache = &ReportNearCache{
+			LRUStats:   stats,
+			BytesSaved: atomic.LoadInt64(&nearCacheStats.BytesSaved),
+			MainGets:   int64(gets) - stats.Hits,
+		}
+	}
+	if len(clientPools) > 1 {
+		report.Tiers = tieredStats
+	}
+	report.SetLatencies(latencies)
+	if resultWriter != nil {
+		report.Results = &ReportResults{Path: options.Results, Written: resultWriter.Written, Dropped: resultWriter.Dropped}
+	}
+	if spanExporter != nil {
+		report.Spans = &ReportResults{Path: options.Spans, Written: spanExporter.Exported, Dropped: spanExporter.Dropped}
+	}
+	if verifier != nil {
+		report.Verify = verifier
+	}
+	report.MaxConcurrency = maxConcurrency
+	report.Clients = atomic.LoadInt32(&numClients)
+	for _, p := range benchclient.Providers() {
+		if p.Report != nil {
+			report.Services = append(report.Services, p.Report()...)
+		}
+	}
+	report.Reader = reader.Report()
+	report.Finish()
+
+	for _, line := range report.Summary() {
+		syslog.Println(line)
+	}
+	if options.Latencies != "" {
+		if err := latencies.Save(options.Latencies); err != nil {
+			log.Warn("Failed to save latencies: %v", err)
+		}
+	}
+	if options.File != "" {
+		if err := report.Save(options.File + "_report.json"); err != nil {
+			log.Warn("Failed to save the report: %v", err)
+		}
 	}
 
 	for _, p := range clientPools {
 		p.Close()
 	}
+	if hedgePool != nil {
+		hedgePool.Close()
+	}
+	if mirrorPool != nil {
+		mirrorPool.Close()
+	}
+	for _, p := range benchclient.Providers() {
+		if p.Close != nil {
+			p.Close()
+		}
+	}
+	if metrics != nil {
+		metrics.Close()
+	}
+	if options.LogSample != "" {
+		log.Info("Log sampling: %v", logSampling)
+	}
+	if fileLogger != nil {
+		fileLogger.Close()
+	}
 }
 
 func finalize(opts *FinalizeOptions) {
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SpanBufferSize Number of requests buffered before spans are dropped.
+	SpanBufferSize = 10000
+
+	// SpanBatchSize Max number of requests exported in a line of the file.
+	SpanBatchSize = 100
+
+	SpanServiceName = "sionreplayer"
+	SpanScopeName   = "github.com/sionreview/sionreplayer/simulator/playback"
+
+	SpanPoolWait = "pool.wait"
+
+	// Span kinds and status codes defined by OTLP.
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+var (
+	// spanRand Generates ids, seeded to avoid collisions between runs.
+	spanRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	spanRandMu sync.Mutex
+)
+
+// Span A timed operation of a request replayed.
+type Span struct {
+	Name       string
+	SpanId     [8]byte
+	ParentId   [8]byte // Zero for the root.
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes []SpanAttribute
+	Result     int // One of PerformResultSuccess, PerformResultError, PerformResultNotFound.
+	Error      string
+}
+
+// SpanAttribute An attribute of a span, the value can be a string, bool, int, int64, uint64 or float64.
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// RequestSpans The span tree of a request replayed: the root span of the request and spans of operations on services.
+// All methods are noops on nil, so spans can be recorded without checking if spans are enabled.
+type RequestSpans struct {
+	TraceId  [16]byte
+	Root     *Span
+	Children []*Span
+	mu       sync.Mutex
+}
+
+// NewRequestSpans starts the span tree of a request, the root span is named on finishing.
+func NewRequestSpans(start time.Time, attrs ...SpanAttribute) *RequestSpans {
+	spans := &RequestSpans{}
+	binary.BigEndian.PutUint64(spans.TraceId[:8], randomSpanId())
+	binary.BigEndian.PutUint64(spans.TraceId[8:], randomSpanId())
+	spans.Root = &Span{Kind: otlpSpanKindInternal, Start: start, Attributes: attrs}
+	binary.BigEndian.PutUint64(spans.Root.SpanId[:], randomSpanId())
+	return spans
+}
+
+// Add adds a span of the operation on the service between start and end. The span of an operation in process, e.g.
+// waiting for a client, has no provider.
+func (s *RequestSpans) Add(name string, provider string, err error, start time.Time, end time.Time, attrs ...SpanAttribute) {
+	if s == nil {
+		return
+	}
+
+	span := &Span{
+		Name:       name,
+		ParentId:   s.Root.SpanId,
+		Kind:       otlpSpanKindInternal,
+		Start:      start,
+		End:        end,
+		Attributes: attrs,
+		Result:     ResultOf(err),
+	}
+	if provider != "" {
+		span.Kind = otlpSpanKindClient
+		span.Attributes = append([]SpanAttribute{{Key: "provider", Value: provider}}, attrs...)
+	}
+	if span.Result == PerformResultError {
+		span.Error = err.Error()
+	}
+	binary.BigEndian.PutUint64(span.SpanId[:], randomSpanId())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Children = append(s.Children, span)
+}
+
+// Since adds a span of the operation on the service since the start.
+func (s *RequestSpans) Since(name string, provider string, err error, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.Add(name, provider, err, start, time.Now())
+}
+
+// Finish ends the root span with the operation and result of the request.
+func (s *RequestSpans) Finish(op string, result int, end time.Time, attrs ...SpanAttribute) {
+	if s == nil {
+		return
+	}
+	s.Root.Name = "replay " + op
+	s.Root.End = end
+	s.Root.Result = result
+	s.Root.Attributes = append(s.Root.Attributes, attrs...)
+}
+
+// Duration returns the duration of the request.
+func (s *RequestSpans) Duration() time.Duration {
+	return s.Root.End.Sub(s.Root.Start)
+}
+
+// SpanExporterOptions Options of exporting spans.
+type SpanExporterOptions struct {
+	// File The path of the OTLP-JSON file, one export request per line.
+	File string
+
+	// Rate The fraction of requests exported in [0, 1].
+	Rate float64
+
+	// Slow Requests not faster than the threshold are always exported, 0 to disable.
+	Slow time.Duration
+}
+
+// SpanExporter Writes sampled span trees to a file in the OTLP-JSON format in background, which can be loaded by trace
+// viewers or the file receiver of OpenTelemetry collectors. Export never blocks the replay: spans are dropped if the
+// buffer is full, or the exporter is closed.
+type SpanExporter struct {
+	Exported int64
+	Dropped  int64
+
+	opts   SpanExporterOptions
+	file   *os.File
+	w      *bufio.Writer
+	spans  chan *RequestSpans
+	done   sync.WaitGroup
+	err    error
+	mu     sync.RWMutex // Guards closing spans against sends.
+	closed bool
+}
+
+func NewSpanExporter(opts SpanExporterOptions) (*SpanExporter, error) {
+	file, err := os.Create(opts.File)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := &SpanExporter{
+		opts:  opts,
+		file:  file,
+		w:     bufio.NewWriter(file),
+		spans: make(chan *RequestSpans, SpanBufferSize),
+	}
+	exporter.done.Add(1)
+	go exporter.serve()
+	return exporter, nil
+}
+
+// Sampled returns true if the request is slow or sampled by the rate.
+func (e *SpanExporter) Sampled(spans *RequestSpans) bool {
+	if e.opts.Slow > 0 && spans.Duration() >= e.opts.Slow {
+		return true
+	}
+	if e.opts.Rate >= 1 {
+		return true
+	} else if e.opts.Rate <= 0 {
+		return false
+	}
+
+	spanRandMu.Lock()
+	defer spanRandMu.Unlock()
+	return spanRand.Float64() < e.opts.Rate
+}
+
+// Export queues the span tree if sampled, or drops it if the buffer is full or the exporter is closed.
+func (e *SpanExporter) Export(spans *RequestSpans) {
+	if spans == nil || !e.Sampled(spans) {
+		return
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		atomic.AddInt64(&e.Dropped, 1)
+		return
+	}
+	select {
+	case e.spans <- spans:
+	default:
+		atomic.AddInt64(&e.Dropped, 1)
+	}
+}
+
+// Close writes spans queued and closes the file.
+func (e *SpanExporter) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	close(e.spans)
+	e.mu.Unlock()
+
+	e.done.Wait()
+	if err := e.w.Flush(); e.err == nil {
+		e.err = err
+	}
+	if err := e.file.Close(); e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
+
+func (e *SpanExporter) serve() {
+	defer e.done.Done()
+
+	batch := make([]*RequestSpans, 0, SpanBatchSize)
+	for spans := range e.spans {
+		batch = append(batch, spans)
+		// Write if the batch is full or no more spans are waiting.
+		if len(batch) < SpanBatchSize && len(e.spans) > 0 {
+			continue
+		}
+		e.write(batch)
+		batch = batch[:0]
+	}
+	if len(batch) > 0 {
+		e.write(batch)
+	}
+}
+
+func (e *SpanExporter) write(batch []*RequestSpans) {
+	if e.err != nil {
+		return
+	}
+
+	request := &otlpTracesData{ResourceSpans: []*otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes(nil, SpanAttribute{Key: "service.name", Value: SpanServiceName})},
+		ScopeSpans: []*otlpScopeSpans{{
+			Scope: otlpScope{Name: SpanScopeName},
+			Spans: make([]*otlpSpan, 0, len(batch)*4),
+		}},
+	}}}
+	scope := request.ResourceSpans[0].ScopeSpans[0]
+	for _, spans := range batch {
+		scope.Spans = append(scope.Spans, newOtlpSpan(spans.TraceId, spans.Root))
+		for _, child := range spans.Children {
+			scope.Spans = append(scope.Spans, newOtlpSpan(spans.TraceId, child))
+		}
+	}
+
+	data, err := json.Marshal(request)
+	if err == nil {
+		data = append(data, '\n')
+		_, err = e.w.Write(data)
+	}
+	if err != nil {
+		e.err = err
+		return
+	}
+	atomic.AddInt64(&e.Exported, int64(len(batch)))
+}
+
+// OTLP-JSON representation of spans. Ids are hex encoded and 64-bit integers are strings, as the OTLP JSON encoding
+// requires.
+type otlpTracesData struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newOtlpSpan(traceId [16]byte, span *Span) *otlpSpan {
+	ret := &otlpSpan{
+		TraceId:           hex.EncodeToString(traceId[:]),
+		SpanId:            hex.EncodeToString(span.SpanId[:]),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:        otlpAttributes(span.Attributes, SpanAttribute{Key: "result", Value: ResultName(span.Result)}),
+		Status:            otlpStatus{Code: otlpStatusOk},
+	}
+	if span.ParentId != [8]byte{} {
+		ret.ParentSpanId = hex.EncodeToString(span.ParentId[:])
+	}
+	if span.Result == PerformResultError {
+		ret.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+	}
+	return ret
+}
+
+func randomSpanId() uint64 {
+	spanRandMu.Lock()
+	defer spanRandMu.Unlock()
+
+	// Zero ids are invalid.
+	for {
+		if id := spanRand.Uint64(); id != 0 {
+			return id
+		}
+	}
+}
+
+func otlpAttributes(attrs []SpanAttribute, extra ...SpanAttribute) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs)+len(extra))
+	for _, attr := range append(attrs[:len(attrs):len(attrs)], extra...) {
+		kv := otlpKeyValue{Key: attr.Key}
+		switch v := attr.Value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			kv.Value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			kv.Value.IntValue = &s
+		case uint64:
+			s := strconv.FormatUint(v, 10)
+			kv.Value.IntValue = &s
+		case float64:
+			kv.Value.DoubleValue = &v
+		default:
+			continue
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/sionreview/sion/client"
+	"github.com/sionreview/sionreplayer/benchclient"
+	"github.com/zhangjyr/hashmap"
+)
+
+const (
+	VerifyResultOK        = 0
+	VerifyResultCorrupted = 1
+	VerifyResultTruncated = 2
+	VerifyResultStale     = 3
+
+	// VerifyStaleVersions Number of previous versions to check before a read is reported corrupted.
+	VerifyStaleVersions = 3
+)
+
+// objectVersions tracks versions written for a key. Sizes of versions are tracked, for keys are reused by objects of
+// different sizes in traces.
+type objectVersions struct {
+	next      uint32 // Last version allocated.
+	committed uint32 // Latest version written successfully.
+	sizes     map[uint32]int
+	checksums map[uint32]uint64
+	mu        sync.Mutex
+}
+
+// Verifier Derives payloads from keys and versions and verifies the bytes read against them.
+type Verifier struct {
+	versions *hashmap.HashMap // map[string]*objectVersions
+
+	Verified  int32
+	Corrupted int32
+	Truncated int32
+	Stale     int32
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{
+		versions: hashmap.New(10000),
+	}
+}
+
+// NextPayload returns the payload of a new version of the key. Call Commit after the payload is written.
+func (v *Verifier) NextPayload(key string, size int) *benchclient.Payload {
+	ver := v.get(key)
+	return benchclient.NewVersionedPayload(key, atomic.AddUint32(&ver.next, 1), size)
+}
+
+// Commit marks the version of the payload as the latest version of the key.
+func (v *Verifier) Commit(payload *benchclient.Payload) {
+	ver := v.get(payload.Key())
+	ver.mu.Lock()
+	defer ver.mu.Unlock()
+
+	if payload.Version() > ver.committed {
+		ver.committed = payload.Version()
+	}
+	if ver.sizes == nil {
+		ver.sizes = make(map[uint32]int, VerifyStaleVersions+1)
+	}
+	ver.sizes[payload.Version()] = payload.Size()
+	for version := range ver.sizes {
+		if version+VerifyStaleVersions < ver.committed {
+			delete(ver.sizes, version)
+			delete(ver.checksums, version)
+		}
+	}
+}
+
+// Verify reads the reader to the end and checks the length and checksum against the latest version written. The size
+// is expected only if no version of the key was written.
+func (v *Verifier) Verify(reqId string, key string, size int, reader client.ReadAllCloser) int {
+	ver := v.get(key)
+	ver.mu.Lock()
+	committed := ver.committed
+	if committedSize, ok := ver.sizes[committed]; ok {
+		size = committedSize
+	}
+	ver.mu.Unlock()
+
+	atomic.AddInt32(&v.Verified, 1)
+	n, sum, err := benchclient.Digest(reader)
+	if err == nil && n == size && sum == v.checksum(ver, key, committed, size) {
+		return VerifyResultOK
+	}
+	if err == nil {
+		for version := committed - 1; version > 0 && version+VerifyStaleVersions >= committed; version-- {
+			if staleSize, ok := v.size(ver, version); ok && staleSize == n && sum == v.checksum(ver, key, version, n) {
+				atomic.AddInt32(&v.Stale, 1)
+				log.Warn("Stale read %s,%s: version %d read, version %d expected", key, reqId, version, committed)
+				return VerifyResultStale
+			}
+		}
+	}
+
+	if err != nil || n < size {
+		atomic.AddInt32(&v.Truncated, 1)
+		log.Warn("Truncated read %s,%s: %d of %d bytes read, version %d(%v)", key, reqId, n, size, committed, err)
+		return VerifyResultTruncated
+	} else if n > size {
+		atomic.AddInt32(&v.Corrupted, 1)
+		log.Warn("Corrupted read %s,%s: %d bytes read, %d bytes expected, version %d", key, reqId, n, size, committed)
+		return VerifyResultCorrupted
+	}
+	atomic.AddInt32(&v.Corrupted, 1)
+	log.Warn("Corrupted read %s,%s: checksum mismatch, version %d", key, reqId, committed)
+	return VerifyResultCorrupted
+}
+
+// size returns the size of the version written.
+func (v *Verifier) size(ver *objectVersions, version uint32) (int, bool) {
+	ver.mu.Lock()
+	defer ver.mu.Unlock()
+
+	size, ok := ver.sizes[version]
+	return size, ok
+}
+
+func (v *Verifier) get(key string) *objectVersions {
+	if ver, ok := v.versions.Get(key); ok {
+		return ver.(*objectVersions)
+	}
+	ver, _ := v.versions.GetOrInsert(key, &objectVersions{})
+	return ver.(*objectVersions)
+}
+
+func (v *Verifier) checksum(ver *objectVersions, key string, version uint32, size int) uint64 {
+	ver.mu.Lock()
+	defer ver.mu.Unlock()
+
+	if sum, ok := ver.checksums[version]; ok {
+		return sum
+	}
+	if ver.checksums == nil {
+		ver.checksums = make(map[uint32]uint64, VerifyStaleVersions+1)
+	}
+	sum := benchclient.NewVersionedPayload(key, version, size).Checksum()
+	ver.checksums[version] = sum
+	return sum
+}